@@ -1,14 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"net"
+	"net/http"
+	"time"
 
 	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
 	"github.com/joho/godotenv"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/config"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/server"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/tracing"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -25,40 +31,73 @@ func NewApplication(config *config.Config) *application {
 }
 
 // Starts the gRPC server on the specified port and begins listening for incoming connections.
+// Once the server was shut down, it waits until the cache server was closed, which writes its final snapshot
+// and flushes its append-only log, before returning.
+//
+// The listener is opened before the cache server joins the cluster, since its peers hand off entries to it
+// as soon as they learn about the new node. Their requests are queued by the listener until the server serves.
 func (app *application) run() {
-	grpcServer := app.mount()
-
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatal().Err(err).Str("port", port).Msg("failed to start listening on the specified port")
 	}
 
+	grpcServer, closed := app.mount()
+
 	log.Info().Str("port", port).Msg("server starting...")
 	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatal().Err(err)
+		log.Fatal().Err(err).Msg("failed to serve")
 	}
+	<-closed
 }
 
 // Configures and initializes the gRPC server with the necessary interceptors and options.
-func (app *application) mount() *grpc.Server {
+// The returned channel is closed once the server was shut down gracefully and the cache server was closed.
+func (app *application) mount() (*grpc.Server, <-chan struct{}) {
 	loggingOpts := []logging.Option{
 		logging.WithLogOnEvents(logging.StartCall, logging.FinishCall),
 	}
-	interceptorOpts := grpc.ChainUnaryInterceptor(
+	cacheServer := server.New(app.config)
+
+	unaryInterceptors := grpc.ChainUnaryInterceptor(
 		logging.UnaryServerInterceptor(server.InterceptorLogger(log.Logger), loggingOpts...),
+		cacheServer.RateLimitUnaryInterceptor(),
+	)
+	streamInterceptors := grpc.ChainStreamInterceptor(
+		logging.StreamServerInterceptor(server.InterceptorLogger(log.Logger), loggingOpts...),
+		cacheServer.RateLimitStreamInterceptor(),
 	)
 
 	opts := app.config.GrpcServerOptions()
-	opts = append(opts, interceptorOpts)
+	opts = append(opts, grpc.StatsHandler(otelgrpc.NewServerHandler()), unaryInterceptors, streamInterceptors)
 
 	grpcServer := grpc.NewServer(opts...)
 
-	pb.RegisterCacheServiceServer(grpcServer, server.New(app.config))
+	pb.RegisterCacheServiceServer(grpcServer, cacheServer)
 	reflection.Register(grpcServer)
 
-	go server.GracefulShutdown(grpcServer, app.config)
+	if app.config.MetricsAddr != "" {
+		go app.serveMetrics(cacheServer.MetricsHandler())
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		server.GracefulShutdown(grpcServer, cacheServer, app.config)
+	}()
 
-	return grpcServer
+	return grpcServer, closed
+}
+
+// Serves the Prometheus metrics of the cache server on the configured address under `/metrics`.
+func (app *application) serveMetrics(handler http.Handler) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+
+	log.Info().Str("addr", app.config.MetricsAddr).Msg("serving metrics...")
+	if err := http.ListenAndServe(app.config.MetricsAddr, mux); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error().Err(err).Str("addr", app.config.MetricsAddr).Msg("failed to serve metrics")
+	}
 }
 
 func main() {
@@ -72,6 +111,18 @@ func main() {
 		log.Fatal().Err(err).Msg("failed to create config")
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingExporter, cfg.Addr)
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to set up tracing")
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to flush traces")
+		}
+	}()
+
 	app := NewApplication(cfg)
 
 	app.run()
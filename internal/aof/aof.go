@@ -0,0 +1,490 @@
+package aof
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"google.golang.org/protobuf/proto"
+)
+
+// FormatVersion is the version of the binary format of the log.
+// Replay rejects logs of other versions instead of misinterpreting them.
+const FormatVersion = 1
+
+const (
+	magic          = "GDCA"  // Identifies an append-only log file.
+	headerSize     = 6       // Size of the magic bytes and the format version.
+	recordOverhead = 8       // Size of the length and checksum preceding each record.
+	maxRecordSize  = 1 << 30 // Upper bound of a record, to reject corrupt lengths before allocating.
+)
+
+// FsyncPolicy names when appended records are flushed to stable storage.
+type FsyncPolicy string
+
+const (
+	FsyncAlways   FsyncPolicy = "always"   // Every record is synced before Append returns.
+	FsyncEverySec FsyncPolicy = "everysec" // Records are synced once per second in the background.
+	FsyncNever    FsyncPolicy = "never"    // Records are handed to the operating system, which decides when to sync.
+)
+
+// ParseFsyncPolicy converts the name of an fsync policy into an FsyncPolicy.
+// It returns an error if the name does not denote a known policy.
+func ParseFsyncPolicy(name string) (FsyncPolicy, error) {
+	switch policy := FsyncPolicy(name); policy {
+	case FsyncAlways, FsyncEverySec, FsyncNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown fsync policy %q", name)
+	}
+}
+
+var (
+	// ErrCorrupt is returned when the header of a log is malformed.
+	ErrCorrupt = errors.New("append-only log is corrupt")
+
+	// ErrUnsupportedVersion is returned when a log was written in an unknown version of the format.
+	ErrUnsupportedVersion = errors.New("append-only log format version is not supported")
+
+	// ErrClosed is returned when appending to or rewriting a closed log.
+	ErrClosed = errors.New("append-only log is closed")
+
+	// ErrRewriteInProgress is returned when a rewrite is requested while another one is running.
+	ErrRewriteInProgress = errors.New("append-only log rewrite is already in progress")
+)
+
+// Log is an append-only log of cache entries, recording the state of each entry after every change.
+//
+// The log starts with a header of the magic bytes "GDCA" and the big-endian uint16 format version. Each record holds
+// the big-endian uint32 length and CRC-32 (IEEE) checksum of its payload, followed by the entry encoded as protobuf.
+// Since entries are versioned, replaying records is idempotent and independent of their order, so the log can be
+// replayed on top of a snapshot that already contains some of them.
+type Log struct {
+	mu         sync.Mutex    // Mutex to synchronize appends, syncs and rewrites.
+	path       string        // Path of the log file.
+	policy     FsyncPolicy   // Policy deciding when appended records are synced.
+	file       *os.File      // Open log file, nil once the log is closed.
+	size       int64         // Current size of the log file in bytes.
+	baseSize   int64         // Size of the log file after it was opened or last rewritten.
+	dirty      bool          // Whether records were appended since the last sync.
+	rewriting  bool          // Whether a rewrite is in progress.
+	rewriteBuf [][]byte      // Records appended while a rewrite is in progress.
+	stopCh     chan struct{} // Closed to signal the background sync goroutine to stop.
+	doneCh     chan struct{} // Closed by the background sync goroutine once it has stopped.
+}
+
+// Open opens the log file at path for appending, creating it if it does not exist.
+// With the `everysec` policy, a background goroutine syncs the file every second until the log is closed.
+// Existing logs should be replayed with Replay before they are opened.
+func Open(path string, policy FsyncPolicy) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	size := info.Size()
+	if size == 0 {
+		if _, err := file.Write(header()); err != nil {
+			file.Close()
+			return nil, err
+		}
+		if err := file.Sync(); err != nil {
+			file.Close()
+			return nil, err
+		}
+		size = headerSize
+	}
+
+	l := &Log{path: path, policy: policy, file: file, size: size, baseSize: size}
+	if policy == FsyncEverySec {
+		l.stopCh = make(chan struct{})
+		l.doneCh = make(chan struct{})
+		go l.runSync(l.stopCh, l.doneCh)
+	}
+
+	return l, nil
+}
+
+// Append writes a record of the entry to the log, syncing it right away with the `always` policy.
+func (l *Log) Append(entry *pb.Entry) error {
+	return l.AppendBatch([]*pb.Entry{entry})
+}
+
+// AppendBatch writes a record of each entry to the log, in order, syncing them at once with the `always` policy.
+func (l *Log) AppendBatch(entries []*pb.Entry) error {
+	records := make([][]byte, 0, len(entries))
+	for _, entry := range entries {
+		record, err := encodeRecord(entry)
+		if err != nil {
+			return err
+		}
+		records = append(records, record)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return ErrClosed
+	}
+
+	for _, record := range records {
+		n, err := l.file.Write(record)
+		l.size += int64(n)
+		if err != nil {
+			return err
+		}
+		if l.rewriting {
+			l.rewriteBuf = append(l.rewriteBuf, record)
+		}
+	}
+
+	if l.policy == FsyncAlways {
+		return l.file.Sync()
+	}
+	l.dirty = true
+
+	return nil
+}
+
+// Sync flushes the appended records to stable storage, regardless of the fsync policy.
+func (l *Log) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return ErrClosed
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.dirty = false
+
+	return nil
+}
+
+// Size returns the current size of the log file in bytes.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.size
+}
+
+// ShouldRewrite reports whether the log grew to at least `minSize` bytes and doubled in size since it was
+// opened or last rewritten, and no rewrite is in progress.
+func (l *Log) ShouldRewrite(minSize int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.file != nil && !l.rewriting && l.size >= minSize && l.size >= 2*l.baseSize
+}
+
+// Rewrite compacts the log into a single record per entry yielded by `rangeFn`, typically the current entries of
+// the cache, and atomically replaces the log file with the result.
+//
+// The entries are written to a temporary file without blocking appends. Appends continue to go to the current
+// log and are buffered as well; once all entries are written, the buffered records are added to the new log,
+// which is synced and renamed over the current one. If the rewrite fails, the current log is kept.
+func (l *Log) Rewrite(rangeFn func(fn func(entry *pb.Entry) bool)) error {
+	l.mu.Lock()
+	if l.file == nil {
+		l.mu.Unlock()
+		return ErrClosed
+	}
+	if l.rewriting {
+		l.mu.Unlock()
+		return ErrRewriteInProgress
+	}
+	l.rewriting = true
+	l.rewriteBuf = nil
+	l.mu.Unlock()
+
+	dir := filepath.Dir(l.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(l.path)+".*.rewrite")
+	if err != nil {
+		l.abortRewrite()
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	size, err := writeEntries(tmp, rangeFn)
+	if err != nil {
+		tmp.Close()
+		l.abortRewrite()
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	defer func() {
+		l.rewriting = false
+		l.rewriteBuf = nil
+	}()
+
+	if l.file == nil {
+		tmp.Close()
+		return ErrClosed
+	}
+
+	for _, record := range l.rewriteBuf {
+		n, err := tmp.Write(record)
+		size += int64(n)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := syncDir(dir); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	// The temporary file is the log now; keep appending to it, without seeking back over the written records.
+	l.file.Close()
+	l.file = tmp
+	l.size = size
+	l.baseSize = size
+	l.dirty = false
+
+	return nil
+}
+
+// Close stops the background sync, syncs the pending records and closes the log file.
+// Calling it on a closed log is a no-op.
+func (l *Log) Close() error {
+	if l.stopCh != nil {
+		close(l.stopCh)
+		<-l.doneCh
+		l.stopCh = nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Sync()
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+
+	return err
+}
+
+// Replay reads the log file at path and calls fn for each record, in the order they were appended.
+// It returns the number of replayed records and the number of bytes discarded from the end of the log.
+//
+// An incomplete final record, i.e. one that was only partially written before a crash, ends the replay.
+// The log is truncated to the last complete record, so that later appends are not hidden behind the broken one.
+// Any other record that cannot be read, e.g. one that does not match its checksum, returns ErrCorrupt and leaves the
+// log untouched, since the records after it may still be intact. A missing log file is treated as an empty log.
+func Replay(path string, fn func(entry *pb.Entry)) (int, int64, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if info.Size() == 0 {
+		return 0, 0, nil
+	}
+
+	r := bufio.NewReader(file)
+	head := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return 0, 0, fmt.Errorf("%w: truncated header", ErrCorrupt)
+	}
+	if string(head[:len(magic)]) != magic {
+		return 0, 0, fmt.Errorf("%w: missing magic bytes", ErrCorrupt)
+	}
+	if version := binary.BigEndian.Uint16(head[len(magic):]); version != FormatVersion {
+		return 0, 0, fmt.Errorf("%w: got version %d, expected %d", ErrUnsupportedVersion, version, FormatVersion)
+	}
+
+	offset := int64(headerSize)
+	count := 0
+	for {
+		entry, n, err := readRecord(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return count, 0, fmt.Errorf("%w: record at offset %d: %w", ErrCorrupt, offset, err)
+		}
+		fn(entry)
+		offset += n
+		count++
+	}
+
+	discarded := info.Size() - offset
+	if discarded > 0 {
+		if err := file.Truncate(offset); err != nil {
+			return count, 0, err
+		}
+		if err := file.Sync(); err != nil {
+			return count, 0, err
+		}
+	}
+
+	return count, discarded, nil
+}
+
+// Syncs the log file every second, if records were appended, until the stop channel is closed.
+func (l *Log) runSync(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			l.mu.Lock()
+			if l.file != nil && l.dirty {
+				// A failed sync is retried on the next tick, the records remain in the page cache.
+				if err := l.file.Sync(); err == nil {
+					l.dirty = false
+				}
+			}
+			l.mu.Unlock()
+		}
+	}
+}
+
+// Resets the state of a failed rewrite, discarding the buffered records.
+func (l *Log) abortRewrite() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rewriting = false
+	l.rewriteBuf = nil
+}
+
+// Writes the header and one record per entry yielded by `rangeFn` to w and returns the number of bytes written.
+func writeEntries(w io.Writer, rangeFn func(fn func(entry *pb.Entry) bool)) (int64, error) {
+	bw := bufio.NewWriter(w)
+	size, err := bw.Write(header())
+	if err != nil {
+		return 0, err
+	}
+
+	written := int64(size)
+	rangeFn(func(entry *pb.Entry) bool {
+		var record []byte
+		record, err = encodeRecord(entry)
+		if err != nil {
+			return false
+		}
+		var n int
+		n, err = bw.Write(record)
+		written += int64(n)
+		return err == nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return written, bw.Flush()
+}
+
+// Returns the header of a log file.
+func header() []byte {
+	return binary.BigEndian.AppendUint16([]byte(magic), FormatVersion)
+}
+
+// Encodes the entry into a record, prefixed with the length and checksum of its payload.
+func encodeRecord(entry *pb.Entry) ([]byte, error) {
+	payload, err := proto.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, recordOverhead, recordOverhead+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+
+	return append(record, payload...), nil
+}
+
+// Reads the next record and returns its entry and size in bytes.
+// It returns io.EOF at the end of the log and io.ErrUnexpectedEOF if the record is incomplete.
+func readRecord(r io.Reader) (*pb.Entry, int64, error) {
+	prefix := make([]byte, recordOverhead)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return nil, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(prefix[0:4])
+	if length > maxRecordSize {
+		return nil, 0, fmt.Errorf("length %d exceeds the maximum record size", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(prefix[4:8]) {
+		return nil, 0, errors.New("checksum mismatch")
+	}
+
+	entry := &pb.Entry{}
+	if err := proto.Unmarshal(payload, entry); err != nil {
+		return nil, 0, err
+	}
+
+	return entry, int64(recordOverhead) + int64(length), nil
+}
+
+// Syncs the directory, so that a rename within it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,174 @@
+package aof_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/aof"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/stretchr/testify/require"
+)
+
+func replayAll(t *testing.T, path string) ([]*pb.Entry, int64) {
+	var entries []*pb.Entry
+	count, discarded, err := aof.Replay(path, func(entry *pb.Entry) {
+		entries = append(entries, entry)
+	})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, len(entries), count, "expected %v, instead got %v", len(entries), count)
+	return entries, discarded
+}
+
+func TestLogAppendAndReplay(t *testing.T) {
+	for _, policy := range []aof.FsyncPolicy{aof.FsyncAlways, aof.FsyncEverySec, aof.FsyncNever} {
+		path := filepath.Join(t.TempDir(), "cache.aof")
+
+		entries, _ := replayAll(t, path)
+		require.Empty(t, entries, "expected no entries, instead got %v", entries)
+
+		l, err := aof.Open(path, policy)
+		require.NoError(t, err, "expected no error, instead got %v", err)
+		for i := 0; i < 10; i++ {
+			err := l.Append(&pb.Entry{Key: fmt.Sprintf("key%d", i), Value: []byte("value"), Version: uint64(i + 1)})
+			require.NoError(t, err, "expected no error, instead got %v", err)
+		}
+		err = l.Append(&pb.Entry{Key: "key0", Version: 11, Tombstone: true})
+		require.NoError(t, err, "expected no error, instead got %v", err)
+		require.NoError(t, l.Close(), "expected no error on close")
+
+		err = l.Append(&pb.Entry{Key: "key0"})
+		require.ErrorIs(t, err, aof.ErrClosed, "expected %v, instead got %v", aof.ErrClosed, err)
+
+		entries, discarded := replayAll(t, path)
+		require.Len(t, entries, 11, "expected %v entries with policy %v, instead got %v", 11, policy, len(entries))
+		require.Zero(t, discarded, "expected no discarded bytes, instead got %v", discarded)
+		require.True(t, entries[10].Tombstone, "expected %v, instead got %v", true, entries[10].Tombstone)
+	}
+}
+
+func TestLogAppendBatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+	l, err := aof.Open(path, aof.FsyncAlways)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	var batch []*pb.Entry
+	for i := 0; i < 10; i++ {
+		batch = append(batch, &pb.Entry{Key: fmt.Sprintf("key%d", i), Value: []byte("value"), Version: uint64(i + 1)})
+	}
+	require.NoError(t, l.AppendBatch(batch), "expected no error on append")
+	require.NoError(t, l.Close(), "expected no error on close")
+
+	entries, _ := replayAll(t, path)
+	require.Len(t, entries, 10, "expected %v entries, instead got %v", 10, len(entries))
+	for i, entry := range entries {
+		require.Equal(t, batch[i].Key, entry.Key, "expected %v, instead got %v", batch[i].Key, entry.Key)
+	}
+}
+
+func TestLogReplayCorruptRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	l, err := aof.Open(path, aof.FsyncAlways)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Append(&pb.Entry{Key: fmt.Sprintf("key%d", i), Value: []byte("value")}), "expected no error on append")
+	}
+	require.NoError(t, l.Close(), "expected no error on close")
+
+	// Flip the last byte of the second record, which is followed by an intact one. The header takes 6 bytes.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	recordSize := (len(data) - 6) / 3
+	data[6+2*recordSize-1] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o644), "expected no error on write")
+
+	var keys []string
+	count, _, err := aof.Replay(path, func(entry *pb.Entry) { keys = append(keys, entry.Key) })
+	require.ErrorIs(t, err, aof.ErrCorrupt, "expected %v, instead got %v", aof.ErrCorrupt, err)
+	require.Equal(t, 1, count, "expected %v, instead got %v", 1, count)
+	require.Equal(t, []string{"key0"}, keys, "expected %v, instead got %v", []string{"key0"}, keys)
+
+	// The log is left untouched, so that the records after the corrupt one are not lost.
+	info, err := os.Stat(path)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, int64(len(data)), info.Size(), "expected %v, instead got %v", len(data), info.Size())
+}
+
+func TestLogReplayTruncatesTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	l, err := aof.Open(path, aof.FsyncAlways)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Append(&pb.Entry{Key: fmt.Sprintf("key%d", i), Value: []byte("value")}), "expected no error on append")
+	}
+	require.NoError(t, l.Close(), "expected no error on close")
+
+	// Simulate a crash in the middle of writing the last record.
+	info, err := os.Stat(path)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.NoError(t, os.Truncate(path, info.Size()-3), "expected no error on truncate")
+
+	entries, discarded := replayAll(t, path)
+	require.Len(t, entries, 2, "expected %v entries, instead got %v", 2, len(entries))
+	require.Positive(t, discarded, "expected discarded bytes, instead got %v", discarded)
+
+	// Records appended after the recovery are replayed as well.
+	l, err = aof.Open(path, aof.FsyncAlways)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.NoError(t, l.Append(&pb.Entry{Key: "key3", Value: []byte("value")}), "expected no error on append")
+	require.NoError(t, l.Close(), "expected no error on close")
+
+	entries, discarded = replayAll(t, path)
+	require.Len(t, entries, 3, "expected %v entries, instead got %v", 3, len(entries))
+	require.Zero(t, discarded, "expected no discarded bytes, instead got %v", discarded)
+	require.Equal(t, "key3", entries[2].Key, "expected %v, instead got %v", "key3", entries[2].Key)
+}
+
+func TestLogRewrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.aof")
+
+	l, err := aof.Open(path, aof.FsyncNever)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	defer l.Close()
+
+	for i := 0; i < 100; i++ {
+		require.NoError(t, l.Append(&pb.Entry{Key: "counter", Value: []byte(fmt.Sprint(i)), Version: uint64(i + 1)}), "expected no error on append")
+	}
+	require.True(t, l.ShouldRewrite(0), "expected %v, instead got %v", true, false)
+	before := l.Size()
+
+	err = l.Rewrite(func(fn func(entry *pb.Entry) bool) {
+		// Records appended while the rewrite is in progress are kept.
+		require.NoError(t, l.Append(&pb.Entry{Key: "other", Value: []byte("value"), Version: 101}), "expected no error on append")
+		fn(&pb.Entry{Key: "counter", Value: []byte("99"), Version: 100})
+	})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Less(t, l.Size(), before, "expected size below %v, instead got %v", before, l.Size())
+	require.False(t, l.ShouldRewrite(0), "expected %v, instead got %v", false, true)
+
+	require.NoError(t, l.Append(&pb.Entry{Key: "last", Value: []byte("value"), Version: 102}), "expected no error on append")
+	require.NoError(t, l.Sync(), "expected no error on sync")
+
+	entries, _ := replayAll(t, path)
+	keys := make([]string, len(entries))
+	for i, entry := range entries {
+		keys[i] = entry.Key
+	}
+	require.Equal(t, []string{"counter", "other", "last"}, keys, "expected %v, instead got %v", []string{"counter", "other", "last"}, keys)
+
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, []string{path}, files, "expected %v, instead got %v", []string{path}, files)
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	policy, err := aof.ParseFsyncPolicy("everysec")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, aof.FsyncEverySec, policy, "expected %v, instead got %v", aof.FsyncEverySec, policy)
+
+	_, err = aof.ParseFsyncPolicy("sometimes")
+	require.Error(t, err, "expected an error for an unknown policy")
+}
@@ -1,7 +1,9 @@
 package cache
 
 import (
+	"bytes"
 	"container/list"
+	"errors"
 	"hash/fnv"
 	"time"
 
@@ -10,16 +12,25 @@ import (
 
 // Represents an individual cache entry.
 type cacheItem struct {
-	value      string    // The actual cached value.
-	version    int       // Version of the cache item, used to manage updates.
-	expiryTime time.Time // Time when the cache item will expire.
+	key         string        // The key associated with the cache item.
+	value       []byte        // The actual cached value, an arbitrary binary payload.
+	contentType string        // Optional content type of the value, as provided by the client.
+	flags       uint32        // Optional client-defined flags of the value.
+	version     uint64        // Version of the cache item, a hybrid logical clock timestamp assigned by the coordinator.
+	expiryTime  time.Time     // Time when the cache item will expire.
+	tombstone   bool          // Marks the item as deleted, retaining its version until it expires.
+	size        int64         // Approximate memory footprint of the item, including its key and bookkeeping overhead.
+	elem        *list.Element // Element of the item in the list maintained by the eviction policy.
+	freq        int           // Access frequency of the item, maintained by the LFU eviction policy.
+	segment     uint8         // Segment of the item, maintained by the W-TinyLFU eviction policy.
 }
 
-// Represents an entry in the eviction list.
-type listEntry struct {
-	key  string     // The key associated with the cache item.
-	item *cacheItem // Pointer to the actual cache item.
-}
+// Approximate memory overhead per cache item in bytes, accounting for the map entry,
+// the list element and the cacheItem struct besides the key, value and content type themselves.
+const itemOverhead = 160
+
+// ErrItemTooLarge is returned when a single cache item exceeds the memory limit of a shard.
+var ErrItemTooLarge = errors.New("cache item exceeds the memory limit of a shard")
 
 // Cache represents a distributed cache with multiple shards for concurrency and efficiency.
 // Each shard manages a subset of cache entries to reduce contention.
@@ -27,18 +38,61 @@ type Cache struct {
 	shards    []*shard      // Slice of cache shards.
 	numShards int           // Number of shards for distributing cache keys.
 	ttl       time.Duration // Time-to-live for cache entries.
+	sweeper   sweeper       // Background sweeper removing expired cache entries.
+}
+
+// Option configures optional behavior of a `Cache`.
+type Option func(*options)
+
+// Holds the optional settings of a `Cache`.
+type options struct {
+	maxMemory int64          // Maximum memory in bytes across all shards, zero means unlimited.
+	policy    EvictionPolicy // Eviction policy used by every shard.
+	listener  Listener       // Listener notified about changes to entries, if any.
+}
+
+// WithMaxMemory bounds the approximate memory used by the cache to `bytes` across all shards.
+// The accounted size of an item comprises its key, its value, its content type and a fixed bookkeeping overhead.
+// A non-positive value disables the memory limit.
+func WithMaxMemory(bytes int64) Option {
+	return func(o *options) {
+		o.maxMemory = bytes
+	}
+}
+
+// WithEvictionPolicy selects the policy used to evict items once a shard is full (default: LRU).
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(o *options) {
+		o.policy = policy
+	}
 }
 
 // Initializes and returns a new `Cache` instance.
-// It distributes the capacity evenly across all shards.
-func New(numShards, capacity int, ttl time.Duration) *Cache {
+// It distributes the capacity and the memory limit evenly across all shards.
+// A non-positive capacity disables the limit on the number of items. Positive limits smaller than the number
+// of shards are rounded up to one item or byte per shard, instead of down to zero, which would disable them.
+func New(numShards, capacity int, ttl time.Duration, opts ...Option) *Cache {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	shards := make([]*shard, numShards)
 	capacityPerShard := capacity / numShards
+	if capacity > 0 {
+		capacityPerShard = max(capacityPerShard, 1)
+	}
+	maxBytesPerShard := o.maxMemory / int64(numShards)
+	if o.maxMemory > 0 {
+		maxBytesPerShard = max(maxBytesPerShard, 1)
+	}
 	for i := 0; i < numShards; i++ {
 		shards[i] = &shard{
-			items:    make(map[string]*list.Element),
-			eviction: list.New(),
+			items:    make(map[string]*cacheItem),
+			policy:   newEvictionPolicy(o.policy),
 			capacity: capacityPerShard,
+			maxBytes: maxBytesPerShard,
+			listener: o.listener,
 		}
 	}
 	return &Cache{
@@ -49,57 +103,235 @@ func New(numShards, capacity int, ttl time.Duration) *Cache {
 }
 
 // Set adds or updates a cache entry with the specified key and value from the SetRequest.
-// If the cache exceeds its capacity, the least-recently-used (LRU) item is evicted.
-func (c *Cache) Set(req *pb.SetRequest) {
+// If the cache exceeds its capacity or its memory limit, items are evicted according to the eviction policy.
+// It returns ErrItemTooLarge if the entry alone exceeds the memory limit of a shard.
+//
+// A request carrying a `Version` assigned by the coordinator is only applied if it supersedes the current entry,
+// so that replicas converge on the last write regardless of the order in which they receive the requests.
+// Without a version, the entry is stored with the version of the current entry incremented by one.
+func (c *Cache) Set(req *pb.SetRequest) error {
+	if !c.Fits(req) {
+		return ErrItemTooLarge
+	}
+
 	shard := c.getShard(req.Key)
 
 	shard.mu.Lock()
 	defer shard.mu.Unlock()
 
-	var nextVersion int = 0
-	if elem, ok := shard.items[req.Key]; ok {
-		nextVersion = elem.Value.(*listEntry).item.version + 1
-		shard.eviction.Remove(elem)
-		delete(shard.items, req.Key)
+	version := req.Version
+	if existing, ok := shard.items[req.Key]; ok {
+		if version == 0 {
+			version = existing.version + 1
+		} else if !supersedes(&pb.Entry{Value: req.Value, Version: version}, existing) {
+			return nil
+		}
+		shard.remove(existing)
 	}
 
-	if shard.eviction.Len() >= shard.capacity {
-		shard.evictLRU()
+	item := &cacheItem{
+		key:         req.Key,
+		value:       req.Value,
+		contentType: req.ContentType,
+		flags:       req.Flags,
+		version:     version,
+		expiryTime:  c.ExpiryTime(req),
+	}
+	shard.add(item)
+	shard.notify(EventSet, item)
+
+	return nil
+}
+
+// Fits reports whether the entry of the SetRequest fits into the memory limit of its shard.
+func (c *Cache) Fits(req *pb.SetRequest) bool {
+	shard := c.getShard(req.Key)
+	return shard.maxBytes <= 0 || itemSize(req.Key, req.Value, req.ContentType) <= shard.maxBytes
+}
+
+// Delete removes the cache entry with the specified key from the DeleteRequest.
+// In its place a tombstone with the request's version, or the next version if it carries none, is recorded,
+// so that a stale replica holding an older version of the entry cannot resurrect it during a quorum read.
+// The tombstone expires after the configured TTL, like any other cache entry, but not before the entry it replaces,
+// since a replica that missed the delete could otherwise resurrect the entry once the tombstone is gone.
+// It never expires if the replaced entry does not.
+func (c *Cache) Delete(req *pb.DeleteRequest) {
+	shard := c.getShard(req.Key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	version := req.Version
+	expiryTime := time.Now().Add(c.ttl)
+	if existing, ok := shard.items[req.Key]; ok {
+		if version == 0 {
+			version = existing.version + 1
+		} else if !supersedes(&pb.Entry{Version: version, Tombstone: true}, existing) {
+			return
+		}
+		if existing.expiryTime.IsZero() || existing.expiryTime.After(expiryTime) {
+			expiryTime = existing.expiryTime
+		}
+		shard.remove(existing)
 	}
 
 	item := &cacheItem{
-		value:      req.Value,
-		version:    nextVersion,
-		expiryTime: time.Now().Add(c.ttl),
+		key:        req.Key,
+		version:    version,
+		expiryTime: expiryTime,
+		tombstone:  true,
 	}
-	elem := shard.eviction.PushFront(&listEntry{key: req.Key, item: item})
-	shard.items[req.Key] = elem
+	shard.add(item)
+	shard.notify(EventDelete, item)
 }
 
 // Retrieves a cache entry by key and returns a GetResponse if the key exists and has not expired.
-// If the item is found, it is moved to the front of the eviction list to mark it as recently used.
+// If the item is found, the access is recorded by the eviction policy.
+//
+// Tombstones of deleted entries are returned as well, flagged with `Tombstone`,
+// so that callers can compare their version against other replicas.
 func (c *Cache) Get(req *pb.GetRequest) (*pb.GetResponse, bool) {
-	shard := c.getShard(req.Key)
+	entry, ok := c.Lookup(req.Key)
+	if !ok {
+		return nil, false
+	}
+
+	return &pb.GetResponse{
+		Value:       entry.Value,
+		Version:     entry.Version,
+		Tombstone:   entry.Tombstone,
+		ContentType: entry.ContentType,
+		Flags:       entry.Flags,
+	}, true
+}
 
-	shard.mu.RLock()
-	defer shard.mu.RUnlock()
+// Lookup retrieves a cache entry by key, like Get, but returns it with its expiry time,
+// as needed to replicate the entry to other nodes. Each lookup is counted as a hit or a miss, see `Stats`.
+func (c *Cache) Lookup(key string) (*pb.Entry, bool) {
+	shard := c.getShard(key)
 
-	elem, ok := shard.items[req.Key]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	item, ok := shard.items[key]
 	if !ok {
+		shard.misses++
 		return nil, false
 	}
 
-	item := elem.Value.(*listEntry).item
-	if shard.evictTTL(item, elem, req.Key) {
+	if shard.evictTTL(item) {
+		shard.misses++
 		return nil, false
 	}
 
-	shard.eviction.MoveToFront(elem)
+	if item.tombstone {
+		shard.misses++
+	} else {
+		shard.hits++
+	}
+	shard.policy.access(item)
 
-	return &pb.GetResponse{
-		Value:   item.value,
-		Version: uint32(item.version),
-	}, true
+	return item.entry(), true
+}
+
+// Range calls fn with a copy of every cache entry that has not expired, including tombstones.
+// The entries of a shard are copied while holding its lock, but fn is called without holding any lock.
+// The iteration stops as soon as fn returns false.
+func (c *Cache) Range(fn func(entry *pb.Entry) bool) {
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		entries := make([]*pb.Entry, 0, len(shard.items))
+		for _, item := range shard.items {
+			if item.expired() {
+				continue
+			}
+			entries = append(entries, item.entry())
+		}
+		shard.mu.Unlock()
+
+		for _, entry := range entries {
+			if !fn(entry) {
+				return
+			}
+		}
+	}
+}
+
+// Merge applies an entry replicated from another node, preserving its version and expiry time.
+// The entry is only applied if it supersedes the local entry for the same key, see `Supersedes`.
+// It returns true if the entry was applied.
+func (c *Cache) Merge(entry *pb.Entry) bool {
+	if !c.Fits(&pb.SetRequest{Key: entry.Key, Value: entry.Value, ContentType: entry.ContentType}) {
+		return false
+	}
+
+	shard := c.getShard(entry.Key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if existing, ok := shard.items[entry.Key]; ok {
+		if !supersedes(entry, existing) {
+			return false
+		}
+		shard.remove(existing)
+	}
+
+	item := &cacheItem{
+		key:         entry.Key,
+		value:       entry.Value,
+		contentType: entry.ContentType,
+		flags:       entry.Flags,
+		version:     entry.Version,
+		tombstone:   entry.Tombstone,
+	}
+	if entry.ExpiryTime != 0 {
+		item.expiryTime = time.Unix(0, entry.ExpiryTime)
+	}
+	shard.add(item)
+	if item.tombstone {
+		shard.notify(EventDelete, item)
+	} else {
+		shard.notify(EventSet, item)
+	}
+
+	return true
+}
+
+// Drop removes the entry for the key without recording a tombstone, provided its version still matches.
+// It is used to release entries the node is no longer responsible for, without discarding concurrent updates.
+// It returns true if the entry was removed.
+func (c *Cache) Drop(key string, version uint64) bool {
+	shard := c.getShard(key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	item, ok := shard.items[key]
+	if !ok || item.version != version {
+		return false
+	}
+	shard.remove(item)
+
+	return true
+}
+
+// ExpiryTime resolves the absolute expiry time for the entry of the SetRequest.
+//
+// An absolute `ExpiryTime` (in unix nanoseconds) assigned by the coordinator takes precedence,
+// followed by the per-key `Ttl` (in seconds) and finally the default TTL of the cache.
+// Entries flagged with `NoExpiry` never expire, which is represented by the zero time.
+func (c *Cache) ExpiryTime(req *pb.SetRequest) time.Time {
+	switch {
+	case req.NoExpiry:
+		return time.Time{}
+	case req.ExpiryTime != 0:
+		return time.Unix(0, req.ExpiryTime)
+	case req.Ttl > 0:
+		return time.Now().Add(time.Duration(req.Ttl) * time.Second)
+	default:
+		return time.Now().Add(c.ttl)
+	}
 }
 
 // Determines the appropriate shard for a given cache key by hashing the key.
@@ -108,6 +340,52 @@ func (c *Cache) getShard(key string) *shard {
 	return c.shards[hash%uint32(c.numShards)]
 }
 
+// Reports whether the cache item has expired; items without an expiry time never expire.
+func (item *cacheItem) expired() bool {
+	return !item.expiryTime.IsZero() && time.Now().After(item.expiryTime)
+}
+
+// Converts the cache item into an Entry for replication to other nodes.
+func (item *cacheItem) entry() *pb.Entry {
+	entry := &pb.Entry{
+		Key:         item.key,
+		Value:       item.value,
+		ContentType: item.contentType,
+		Flags:       item.flags,
+		Version:     item.version,
+		Tombstone:   item.tombstone,
+	}
+	if !item.expiryTime.IsZero() {
+		entry.ExpiryTime = item.expiryTime.UnixNano()
+	}
+	return entry
+}
+
+// Reports whether the replicated entry supersedes the local cache item.
+func supersedes(entry *pb.Entry, item *cacheItem) bool {
+	return Supersedes(entry.Version, entry.Tombstone, entry.Value, item.version, item.tombstone, item.value)
+}
+
+// Supersedes reports whether a write (version, tombstone, value) wins over another write under last-writer-wins.
+//
+// The higher version wins. Two coordinators may assign the same version to concurrent writes, so ties are broken
+// deterministically, allowing all replicas to converge on the same write: a tombstone wins, so that deletes are
+// never undone by a tie, followed by the greater value.
+func Supersedes(version uint64, tombstone bool, value []byte, otherVersion uint64, otherTombstone bool, otherValue []byte) bool {
+	if version != otherVersion {
+		return version > otherVersion
+	}
+	if tombstone != otherTombstone {
+		return tombstone
+	}
+	return bytes.Compare(value, otherValue) > 0
+}
+
+// Computes the approximate memory footprint of a cache item in bytes.
+func itemSize(key string, value []byte, contentType string) int64 {
+	return int64(len(key)+len(value)+len(contentType)) + itemOverhead
+}
+
 // Hashes a string key using the FNV-1a hash algorithm.
 func fnv32(key string) uint32 {
 	hsh := fnv.New32a()
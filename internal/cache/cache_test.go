@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/rand"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -15,10 +16,10 @@ import (
 
 func TestCacheSetGet(t *testing.T) {
 	cache := cache.New(1, 10, 3600*time.Second)
-	req := &pb.SetRequest{Key: "key1", Value: "value1"}
+	req := &pb.SetRequest{Key: "key1", Value: []byte("value1")}
 	cache.Set(req)
 
-	expected := &pb.GetResponse{Value: "value1", Version: 0}
+	expected := &pb.GetResponse{Value: []byte("value1"), Version: 0}
 	result, ok := cache.Get(&pb.GetRequest{Key: "key1"})
 	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
 	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
@@ -26,26 +27,216 @@ func TestCacheSetGet(t *testing.T) {
 
 func TestCacheSetWithVersion(t *testing.T) {
 	cache := cache.New(1, 10, 3600*time.Second)
-	req := &pb.SetRequest{Key: "key1", Value: "value1"}
+	req := &pb.SetRequest{Key: "key1", Value: []byte("value1")}
 	cache.Set(req)
 
-	expected := &pb.GetResponse{Value: "value1", Version: 0}
+	expected := &pb.GetResponse{Value: []byte("value1"), Version: 0}
 	result, ok := cache.Get(&pb.GetRequest{Key: "key1"})
 	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
 	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
 
-	req = &pb.SetRequest{Key: "key1", Value: "value2"}
+	req = &pb.SetRequest{Key: "key1", Value: []byte("value2")}
 	cache.Set(req)
 
-	expected = &pb.GetResponse{Value: "value2", Version: 1}
+	expected = &pb.GetResponse{Value: []byte("value2"), Version: 1}
 	result, ok = cache.Get(&pb.GetRequest{Key: "key1"})
 	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
 	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
 }
 
+func TestCacheDelete(t *testing.T) {
+	cache := cache.New(1, 10, 3600*time.Second)
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	cache.Delete(&pb.DeleteRequest{Key: "key1"})
+
+	expected := &pb.GetResponse{Version: 1, Tombstone: true}
+	result, ok := cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value2")})
+
+	expected = &pb.GetResponse{Value: []byte("value2"), Version: 2}
+	result, ok = cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+}
+
+func TestCacheDeleteTombstoneExpiry(t *testing.T) {
+	cache := cache.New(1, 10, time.Second)
+
+	// The tombstone of an entry that never expires never expires either.
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1"), NoExpiry: true})
+	cache.Delete(&pb.DeleteRequest{Key: "key1"})
+	entry, ok := cache.Lookup("key1")
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.True(t, entry.Tombstone, "unexpected value, expected %v instead got %v", true, entry.Tombstone)
+	require.Zero(t, entry.ExpiryTime, "unexpected value, expected %v instead got %v", 0, entry.ExpiryTime)
+
+	// The tombstone of an entry with a longer TTL is kept until the entry would have expired.
+	cache.Set(&pb.SetRequest{Key: "key2", Value: []byte("value2"), Ttl: 3600})
+	expected, _ := cache.Lookup("key2")
+	cache.Delete(&pb.DeleteRequest{Key: "key2"})
+	entry, ok = cache.Lookup("key2")
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected.ExpiryTime, entry.ExpiryTime, "unexpected value, expected %v instead got %v", expected.ExpiryTime, entry.ExpiryTime)
+
+	// Otherwise the tombstone expires after the configured TTL.
+	cache.Delete(&pb.DeleteRequest{Key: "key3"})
+	entry, ok = cache.Lookup("key3")
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.WithinDuration(t, time.Now().Add(time.Second), time.Unix(0, entry.ExpiryTime), 100*time.Millisecond, "unexpected value, expected %v instead got %v", time.Now().Add(time.Second), time.Unix(0, entry.ExpiryTime))
+}
+
+func TestCacheSetBinaryValue(t *testing.T) {
+	cache := cache.New(1, 10, 3600*time.Second)
+	value := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0xfe}
+	cache.Set(&pb.SetRequest{Key: "key1", Value: value, ContentType: "image/png", Flags: 3})
+
+	expected := &pb.GetResponse{Value: value, Version: 0, ContentType: "image/png", Flags: 3}
+	result, ok := cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+}
+
+func TestCacheIncrement(t *testing.T) {
+	c := cache.New(1, 10, 3600*time.Second)
+
+	entry, value, err := c.Increment(&pb.IncrementRequest{Key: "counter", Delta: 5, Initial: 10}, 0)
+	require.NoError(t, err, "unexpected error, expected %v instead got %v", nil, err)
+	require.Equal(t, int64(15), value, "unexpected value, expected %v instead got %v", 15, value)
+	require.Equal(t, "15", string(entry.Value), "unexpected value, expected %v instead got %v", "15", string(entry.Value))
+
+	_, value, err = c.Increment(&pb.IncrementRequest{Key: "counter", Delta: -20, Initial: 10}, 0)
+	require.NoError(t, err, "unexpected error, expected %v instead got %v", nil, err)
+	require.Equal(t, int64(-5), value, "unexpected value, expected %v instead got %v", -5, value)
+
+	expected := &pb.GetResponse{Value: []byte("-5"), Version: 1}
+	result, ok := c.Get(&pb.GetRequest{Key: "counter"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+
+	// An increment supersedes an existing entry with a higher version than the one it was given.
+	c.Set(&pb.SetRequest{Key: "ahead", Value: []byte("7"), Version: 100})
+	entry, value, err = c.Increment(&pb.IncrementRequest{Key: "ahead", Delta: 1}, 50)
+	require.NoError(t, err, "unexpected error, expected %v instead got %v", nil, err)
+	require.Equal(t, int64(8), value, "unexpected value, expected %v instead got %v", 8, value)
+	require.Equal(t, uint64(101), entry.Version, "unexpected value, expected %v instead got %v", 101, entry.Version)
+
+	c.Set(&pb.SetRequest{Key: "text", Value: []byte("value")})
+	_, _, err = c.Increment(&pb.IncrementRequest{Key: "text", Delta: 1}, 0)
+	require.ErrorIs(t, err, cache.ErrNotInteger, "unexpected error, expected %v instead got %v", cache.ErrNotInteger, err)
+
+	c.Set(&pb.SetRequest{Key: "max", Value: []byte("9223372036854775807")})
+	_, _, err = c.Increment(&pb.IncrementRequest{Key: "max", Delta: 1}, 0)
+	require.ErrorIs(t, err, cache.ErrOverflow, "unexpected error, expected %v instead got %v", cache.ErrOverflow, err)
+}
+
+func TestCacheListener(t *testing.T) {
+	var events []cache.Event
+	c := cache.New(1, 10, 3600*time.Second, cache.WithListener(func(event cache.Event) {
+		events = append(events, event)
+	}))
+
+	c.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	c.Delete(&pb.DeleteRequest{Key: "key1"})
+	c.Merge(&pb.Entry{Key: "key2", Value: []byte("value2"), Version: 7})
+	c.Set(&pb.SetRequest{Key: "key3", Value: []byte("value3"), ExpiryTime: time.Now().Add(-time.Second).UnixNano()})
+	c.Get(&pb.GetRequest{Key: "key3"})
+
+	expected := []cache.EventType{cache.EventSet, cache.EventDelete, cache.EventSet, cache.EventSet, cache.EventExpire}
+	require.Len(t, events, len(expected), "unexpected value, expected %v instead got %v", len(expected), len(events))
+	for i, event := range events {
+		require.Equal(t, expected[i], event.Type, "unexpected value, expected %v instead got %v", expected[i], event.Type)
+	}
+	require.Equal(t, "key2", events[2].Entry.Key, "unexpected value, expected %v instead got %v", "key2", events[2].Entry.Key)
+	require.Equal(t, uint64(7), events[2].Entry.Version, "unexpected value, expected %v instead got %v", 7, events[2].Entry.Version)
+}
+
+func TestCacheMerge(t *testing.T) {
+	cache := cache.New(1, 10, 3600*time.Second)
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value2")})
+
+	applied := cache.Merge(&pb.Entry{Key: "key1", Value: []byte("stale"), Version: 0})
+	require.False(t, applied, "unexpected value, expected %v instead got %v", false, applied)
+
+	applied = cache.Merge(&pb.Entry{Key: "key1", Version: 1, Tombstone: true})
+	require.True(t, applied, "unexpected value, expected %v instead got %v", true, applied)
+
+	applied = cache.Merge(&pb.Entry{Key: "key2", Value: []byte("value2"), Version: 7})
+	require.True(t, applied, "unexpected value, expected %v instead got %v", true, applied)
+
+	expected := &pb.GetResponse{Version: 1, Tombstone: true}
+	result, ok := cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+
+	expected = &pb.GetResponse{Value: []byte("value2"), Version: 7}
+	result, ok = cache.Get(&pb.GetRequest{Key: "key2"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+}
+
+func TestCacheSetLastWriterWins(t *testing.T) {
+	cache := cache.New(1, 10, 3600*time.Second)
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value2"), Version: 10})
+
+	// Writes with an older version arriving late are ignored.
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("stale"), Version: 5})
+	cache.Delete(&pb.DeleteRequest{Key: "key1", Version: 5})
+
+	expected := &pb.GetResponse{Value: []byte("value2"), Version: 10}
+	result, ok := cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+
+	// Concurrent writes with the same version converge regardless of their order.
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1"), Version: 10})
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value3"), Version: 10})
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1"), Version: 10})
+
+	expected = &pb.GetResponse{Value: []byte("value3"), Version: 10}
+	result, ok = cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+
+	cache.Delete(&pb.DeleteRequest{Key: "key1", Version: 10})
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value4"), Version: 10})
+
+	expected = &pb.GetResponse{Version: 10, Tombstone: true}
+	result, ok = cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
+}
+
+func TestCacheRangeAndDrop(t *testing.T) {
+	cache := cache.New(4, 100, 3600*time.Second)
+	for i := 0; i < 10; i++ {
+		cache.Set(&pb.SetRequest{Key: strconv.Itoa(i), Value: []byte("value")})
+	}
+	cache.Set(&pb.SetRequest{Key: "expired", Value: []byte("value"), ExpiryTime: time.Now().Add(-time.Second).UnixNano()})
+
+	var entries []*pb.Entry
+	cache.Range(func(entry *pb.Entry) bool {
+		entries = append(entries, entry)
+		return true
+	})
+	require.Len(t, entries, 10, "unexpected len, expected %d instead got %d", 10, len(entries))
+
+	dropped := cache.Drop("1", 1)
+	require.False(t, dropped, "unexpected value, expected %v instead got %v", false, dropped)
+
+	dropped = cache.Drop("1", 0)
+	require.True(t, dropped, "unexpected value, expected %v instead got %v", true, dropped)
+
+	_, ok := cache.Get(&pb.GetRequest{Key: "1"})
+	require.False(t, ok, "unexpected value, expected %v instead got %v", false, ok)
+}
+
 func TestCacheTTLEvicted(t *testing.T) {
 	cache := cache.New(1, 10, 1*time.Millisecond)
-	cache.Set(&pb.SetRequest{Key: "key1", Value: "value1"})
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
 
 	time.Sleep(2 * time.Millisecond)
 
@@ -55,32 +246,190 @@ func TestCacheTTLEvicted(t *testing.T) {
 
 func TestCacheTTLNotEvicted(t *testing.T) {
 	cache := cache.New(1, 10, 10*time.Second)
-	cache.Set(&pb.SetRequest{Key: "key1", Value: "value1"})
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
 
 	_, ok := cache.Get(&pb.GetRequest{Key: "key1"})
 	require.True(t, ok, "unexpected value, expected %v insteag got %v", true, ok)
 }
 
+func TestCacheTTLPerKey(t *testing.T) {
+	cache := cache.New(1, 10, 10*time.Second)
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1"), Ttl: 1})
+	cache.Set(&pb.SetRequest{Key: "key2", Value: []byte("value2"), ExpiryTime: time.Now().Add(-time.Second).UnixNano()})
+	cache.Set(&pb.SetRequest{Key: "key3", Value: []byte("value3"), NoExpiry: true})
+
+	_, ok := cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v insteag got %v", true, ok)
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key2"})
+	require.False(t, ok, "unexpected value, expected %v insteag got %v", false, ok)
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key3"})
+	require.True(t, ok, "unexpected value, expected %v insteag got %v", true, ok)
+}
+
+func TestCacheExpiryTime(t *testing.T) {
+	cache := cache.New(1, 10, 10*time.Second)
+	expiryTime := time.Now().Add(time.Minute)
+
+	result := cache.ExpiryTime(&pb.SetRequest{Key: "key1", Ttl: 60, ExpiryTime: expiryTime.UnixNano()})
+	require.True(t, expiryTime.Equal(result), "unexpected value, expected %v instead got %v", expiryTime, result)
+
+	result = cache.ExpiryTime(&pb.SetRequest{Key: "key1", NoExpiry: true})
+	require.True(t, result.IsZero(), "unexpected value, expected zero time instead got %v", result)
+}
+
+func TestCacheSweeper(t *testing.T) {
+	cache := cache.New(2, 100, 1*time.Millisecond)
+	for i := 0; i < 50; i++ {
+		cache.Set(&pb.SetRequest{Key: strconv.Itoa(i), Value: []byte("value")})
+	}
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1"), NoExpiry: true})
+
+	cache.StartSweeper(5 * time.Millisecond)
+	require.Eventually(t, func() bool {
+		return cache.Stats().SweptItems == 50
+	}, time.Second, 5*time.Millisecond, "expected all expired items to be swept")
+	cache.StopSweeper()
+
+	_, ok := cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v insteag got %v", true, ok)
+	require.NotZero(t, cache.Stats().SweepRuns, "expected sweep runs to be counted")
+}
+
 func TestCacheLRU(t *testing.T) {
 	cache := cache.New(1, 2, 10*time.Second)
-	cache.Set(&pb.SetRequest{Key: "key1", Value: "value1"})
-	cache.Set(&pb.SetRequest{Key: "key2", Value: "value2"})
-	cache.Set(&pb.SetRequest{Key: "key3", Value: "value3"})
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	cache.Set(&pb.SetRequest{Key: "key2", Value: []byte("value2")})
+	cache.Set(&pb.SetRequest{Key: "key3", Value: []byte("value3")})
 
 	_, ok := cache.Get(&pb.GetRequest{Key: "key1"})
 	require.False(t, ok, "unexpected value, expected %v instead got %v", false, ok)
 
-	expected := &pb.GetResponse{Value: "value2", Version: 0}
+	expected := &pb.GetResponse{Value: []byte("value2"), Version: 0}
 	result, ok := cache.Get(&pb.GetRequest{Key: "key2"})
 	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
 	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
 
-	expected = &pb.GetResponse{Value: "value3", Version: 0}
+	expected = &pb.GetResponse{Value: []byte("value3"), Version: 0}
 	result, ok = cache.Get(&pb.GetRequest{Key: "key3"})
 	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
 	require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
 }
 
+func TestCacheMaxMemory(t *testing.T) {
+	// Each item accounts for 4 bytes of key, 6 bytes of value and 160 bytes of overhead.
+	cache := cache.New(1, 0, 10*time.Second, cache.WithMaxMemory(2*170))
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	cache.Set(&pb.SetRequest{Key: "key2", Value: []byte("value2")})
+	cache.Set(&pb.SetRequest{Key: "key3", Value: []byte("value3")})
+
+	_, ok := cache.Get(&pb.GetRequest{Key: "key1"})
+	require.False(t, ok, "unexpected value, expected %v instead got %v", false, ok)
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key2"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+
+	// A larger item evicts as many items as needed to stay within the budget.
+	cache.Set(&pb.SetRequest{Key: "key4", Value: []byte(strings.Repeat("v", 100))})
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key2"})
+	require.False(t, ok, "unexpected value, expected %v instead got %v", false, ok)
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key3"})
+	require.False(t, ok, "unexpected value, expected %v instead got %v", false, ok)
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key4"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+}
+
+func TestCacheMaxMemoryItemTooLarge(t *testing.T) {
+	c := cache.New(1, 10, 10*time.Second, cache.WithMaxMemory(200))
+	err := c.Set(&pb.SetRequest{Key: "key1", Value: []byte(strings.Repeat("v", 100))})
+	require.ErrorIs(t, err, cache.ErrItemTooLarge, "unexpected error, expected %v instead got %v", cache.ErrItemTooLarge, err)
+}
+
+func TestCacheLimitsSmallerThanShards(t *testing.T) {
+	// Limits smaller than the number of shards still apply to each shard, rather than being disabled.
+	c := cache.New(4, 2, 10*time.Second)
+	for i := 0; i < 100; i++ {
+		c.Set(&pb.SetRequest{Key: fmt.Sprintf("key%d", i), Value: []byte("value")})
+	}
+	items := 0
+	for _, n := range c.Stats().ShardItems {
+		items += n
+	}
+	require.LessOrEqual(t, items, 4, "unexpected value, expected at most %v instead got %v", 4, items)
+
+	c = cache.New(4, 0, 10*time.Second, cache.WithMaxMemory(2))
+	err := c.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	require.ErrorIs(t, err, cache.ErrItemTooLarge, "unexpected error, expected %v instead got %v", cache.ErrItemTooLarge, err)
+}
+
+func TestCacheLFU(t *testing.T) {
+	cache := cache.New(1, 2, 10*time.Second, cache.WithEvictionPolicy(cache.LFU))
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	cache.Set(&pb.SetRequest{Key: "key2", Value: []byte("value2")})
+	cache.Get(&pb.GetRequest{Key: "key1"})
+	cache.Set(&pb.SetRequest{Key: "key3", Value: []byte("value3")})
+
+	_, ok := cache.Get(&pb.GetRequest{Key: "key2"})
+	require.False(t, ok, "unexpected value, expected %v instead got %v", false, ok)
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key1"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key3"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+}
+
+func TestCacheFIFO(t *testing.T) {
+	cache := cache.New(1, 2, 10*time.Second, cache.WithEvictionPolicy(cache.FIFO))
+	cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	cache.Set(&pb.SetRequest{Key: "key2", Value: []byte("value2")})
+	cache.Get(&pb.GetRequest{Key: "key1"})
+	cache.Set(&pb.SetRequest{Key: "key3", Value: []byte("value3")})
+
+	_, ok := cache.Get(&pb.GetRequest{Key: "key1"})
+	require.False(t, ok, "unexpected value, expected %v instead got %v", false, ok)
+
+	_, ok = cache.Get(&pb.GetRequest{Key: "key2"})
+	require.True(t, ok, "unexpected value, expected %v instead got %v", true, ok)
+}
+
+func TestCacheTinyLFUScanResistance(t *testing.T) {
+	cache := cache.New(1, 100, 10*time.Second, cache.WithEvictionPolicy(cache.TinyLFU))
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 50; i++ {
+			key := fmt.Sprintf("hot-%d", i)
+			if _, ok := cache.Get(&pb.GetRequest{Key: key}); !ok {
+				cache.Set(&pb.SetRequest{Key: key, Value: []byte("value")})
+			}
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		cache.Set(&pb.SetRequest{Key: fmt.Sprintf("scan-%d", i), Value: []byte("value")})
+	}
+
+	hits := 0
+	for i := 0; i < 50; i++ {
+		if _, ok := cache.Get(&pb.GetRequest{Key: fmt.Sprintf("hot-%d", i)}); ok {
+			hits++
+		}
+	}
+	require.Equal(t, 50, hits, "unexpected value, expected %v instead got %v", 50, hits)
+}
+
+func TestParseEvictionPolicy(t *testing.T) {
+	policy, err := cache.ParseEvictionPolicy("tinylfu")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, cache.TinyLFU, policy, "unexpected value, expected %v instead got %v", cache.TinyLFU, policy)
+
+	_, err = cache.ParseEvictionPolicy("random")
+	require.Error(t, err, "expected an error, instead got %v", err)
+}
+
 func TestCacheConcurrency(t *testing.T) {
 	cache := cache.New(1, 10, 1*time.Hour)
 	var wg sync.WaitGroup
@@ -98,11 +447,11 @@ func TestCacheConcurrency(t *testing.T) {
 				key := strconv.Itoa(j)
 				value := "value" + key
 
-				cache.Set(&pb.SetRequest{Key: key, Value: value})
+				cache.Set(&pb.SetRequest{Key: key, Value: []byte(value)})
 				result, ok := cache.Get(&pb.GetRequest{Key: key})
 
 				if ok {
-					expected := &pb.GetResponse{Value: value, Version: 0}
+					expected := &pb.GetResponse{Value: []byte(value), Version: 0}
 					require.Equal(t, expected, result, "unexpected value, expected %v instead got %v", expected, result)
 				}
 			}
@@ -112,7 +461,7 @@ func TestCacheConcurrency(t *testing.T) {
 
 func BenchmarkCacheSet(b *testing.B) {
 	cache := cache.New(100, 1000000, time.Second*3600)
-	req := &pb.SetRequest{Key: "test-key", Value: "test-value"}
+	req := &pb.SetRequest{Key: "test-key", Value: []byte("test-value")}
 
 	b.ResetTimer()
 
@@ -129,7 +478,7 @@ func BenchmarkCacheGet(b *testing.B) {
 	for i := 0; i < cacheSize; i++ {
 		key := fmt.Sprintf("test-key-%d", i)
 		value := fmt.Sprintf("test-value-%d", i)
-		req := &pb.SetRequest{Key: key, Value: value}
+		req := &pb.SetRequest{Key: key, Value: []byte(value)}
 		cache.Set(req)
 		keys = append(keys, key)
 	}
@@ -155,7 +504,7 @@ func BenchmarkCacheMixedParallel(b *testing.B) {
 	for i := 0; i < cacheSize; i++ {
 		key := fmt.Sprintf("test-key-%d", i)
 		value := fmt.Sprintf("test-value-%d", i)
-		req := &pb.SetRequest{Key: key, Value: value}
+		req := &pb.SetRequest{Key: key, Value: []byte(value)}
 		cache.Set(req)
 		keys = append(keys, key)
 	}
@@ -165,7 +514,7 @@ func BenchmarkCacheMixedParallel(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		key := keys[i%len(keys)]
 		getReqs[i] = &pb.GetRequest{Key: key}
-		setReqs[i] = &pb.SetRequest{Key: key, Value: "value"}
+		setReqs[i] = &pb.SetRequest{Key: key, Value: []byte("value")}
 	}
 
 	b.ResetTimer()
@@ -183,3 +532,85 @@ func BenchmarkCacheMixedParallel(b *testing.B) {
 		}
 	})
 }
+
+// Records a synthetic access trace of `length` keys, where `hot` keys are drawn from a Zipf distribution.
+// Every `scanEvery` accesses, a scan over `scanLength` distinct one-off keys is interleaved.
+func recordTrace(length, hot, scanEvery, scanLength int) []string {
+	rng := rand.New(rand.NewSource(42))
+	zipf := rand.NewZipf(rng, 1.1, 1, uint64(hot-1))
+
+	trace := make([]string, 0, length)
+	scanned := 0
+	for len(trace) < length {
+		if scanEvery > 0 && len(trace) > 0 && len(trace)%scanEvery == 0 {
+			for i := 0; i < scanLength && len(trace) < length; i++ {
+				trace = append(trace, fmt.Sprintf("scan-%d", scanned))
+				scanned++
+			}
+		}
+		trace = append(trace, fmt.Sprintf("hot-%d", zipf.Uint64()))
+	}
+	return trace
+}
+
+func BenchmarkCacheHitRatio(b *testing.B) {
+	traces := map[string][]string{
+		"zipf":      recordTrace(200000, 10000, 0, 0),
+		"zipf-scan": recordTrace(200000, 10000, 5000, 2000),
+	}
+	policies := []cache.EvictionPolicy{cache.LRU, cache.LFU, cache.FIFO, cache.TinyLFU}
+
+	for name, trace := range traces {
+		for _, policy := range policies {
+			b.Run(fmt.Sprintf("%s/%s", name, policy), func(b *testing.B) {
+				cache := cache.New(1, 1000, time.Hour, cache.WithEvictionPolicy(policy))
+				hits := 0
+
+				b.ResetTimer()
+
+				for i := 0; i < b.N; i++ {
+					key := trace[i%len(trace)]
+					if _, ok := cache.Get(&pb.GetRequest{Key: key}); ok {
+						hits++
+					} else {
+						cache.Set(&pb.SetRequest{Key: key, Value: []byte("value")})
+					}
+				}
+
+				b.ReportMetric(100*float64(hits)/float64(b.N), "hit%")
+			})
+		}
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	cache := cache.New(2, 4, 3600*time.Second)
+	for i := 0; i < 6; i++ {
+		cache.Set(&pb.SetRequest{Key: strconv.Itoa(i), Value: []byte("value")})
+	}
+	cache.Set(&pb.SetRequest{Key: "expired", Value: []byte("value"), ExpiryTime: time.Now().Add(-time.Second).UnixNano()})
+	cache.Delete(&pb.DeleteRequest{Key: "deleted"})
+
+	hits := 0
+	for i := 0; i < 6; i++ {
+		if _, ok := cache.Get(&pb.GetRequest{Key: strconv.Itoa(i)}); ok {
+			hits++
+		}
+	}
+	cache.Get(&pb.GetRequest{Key: "missing"})
+	cache.Get(&pb.GetRequest{Key: "expired"})
+	cache.Get(&pb.GetRequest{Key: "deleted"})
+
+	stats := cache.Stats()
+	require.Equal(t, uint64(hits), stats.Hits, "unexpected value, expected %v instead got %v", hits, stats.Hits)
+	require.Equal(t, uint64(6-hits+3), stats.Misses, "unexpected value, expected %v instead got %v", 6-hits+3, stats.Misses)
+	require.NotZero(t, stats.Evictions, "unexpected value, expected evictions instead got %v", stats.Evictions)
+	require.Equal(t, uint64(1), stats.Expirations, "unexpected value, expected %v instead got %v", 1, stats.Expirations)
+	require.Len(t, stats.ShardItems, 2, "unexpected value, expected %v shards instead got %v", 2, len(stats.ShardItems))
+
+	items := 0
+	for _, n := range stats.ShardItems {
+		items += n
+	}
+	require.Equal(t, hits+1, items, "unexpected value, expected %v instead got %v", hits+1, items)
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+)
+
+var (
+	// ErrNotInteger is returned when a counter operation is applied to a value that is not a decimal integer.
+	ErrNotInteger = errors.New("cache value is not a decimal integer")
+
+	// ErrOverflow is returned when a counter operation would overflow a 64-bit signed integer.
+	ErrOverflow = errors.New("cache value would overflow")
+)
+
+// Increment atomically adds the delta of the IncrementRequest to the counter stored under its key,
+// holding the lock of the owning shard for the whole read-modify-write.
+//
+// Counters are stored as decimal integers, so that they can be read like any other value. If the key does not exist,
+// was deleted or has expired, the counter is created with the initial value of the request before the delta is added,
+// expiring after the request's `Ttl` or the default TTL of the cache. Existing counters keep their expiry time.
+// The entry is stored with the given version, raised past the version of the existing entry if necessary,
+// e.g. because it was written by a node whose clock runs ahead, so that the increment always supersedes it.
+// It is returned for replication together with the new value of the counter.
+func (c *Cache) Increment(req *pb.IncrementRequest, version uint64) (*pb.Entry, int64, error) {
+	shard := c.getShard(req.Key)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	current := req.Initial
+	expiryTime := c.ExpiryTime(&pb.SetRequest{Ttl: req.Ttl})
+
+	existing, ok := shard.items[req.Key]
+	if ok && shard.evictTTL(existing) {
+		ok = false
+	}
+	if ok {
+		version = max(version, existing.version+1)
+		if !existing.tombstone {
+			value, err := strconv.ParseInt(string(existing.value), 10, 64)
+			if err != nil {
+				return nil, 0, ErrNotInteger
+			}
+			current = value
+			expiryTime = existing.expiryTime
+		}
+	}
+
+	sum := current + req.Delta
+	if (req.Delta > 0 && sum < current) || (req.Delta < 0 && sum > current) {
+		return nil, 0, ErrOverflow
+	}
+
+	if ok {
+		shard.remove(existing)
+	}
+	item := &cacheItem{
+		key:        req.Key,
+		value:      strconv.AppendInt(nil, sum, 10),
+		version:    version,
+		expiryTime: expiryTime,
+	}
+	shard.add(item)
+	shard.notify(EventSet, item)
+
+	return item.entry(), sum, nil
+}
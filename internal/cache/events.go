@@ -0,0 +1,40 @@
+package cache
+
+import "github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+
+// EventType names the kind of change to a cache entry reported to a Listener.
+type EventType uint8
+
+const (
+	EventSet    EventType = iota + 1 // An entry was created or updated.
+	EventDelete                      // An entry was deleted, leaving a tombstone.
+	EventExpire                      // An entry expired and was removed.
+)
+
+// Event describes a change to a cache entry.
+type Event struct {
+	Type  EventType // Kind of the change.
+	Entry *pb.Entry // Copy of the entry after the change; for expirations, the entry that expired.
+}
+
+// Listener is notified about every change to the entries of a cache, e.g. to feed watchers of keys.
+//
+// Listeners are called synchronously while the lock of the affected shard is held, so they must return
+// quickly and must not call back into the cache. Changes to the same key are reported in the order they happened.
+type Listener func(event Event)
+
+// WithListener registers a Listener notified about sets, deletes and expirations of cache entries.
+// Evicting entries to make room for others and releasing entries after rebalancing are not reported.
+func WithListener(listener Listener) Option {
+	return func(o *options) {
+		o.listener = listener
+	}
+}
+
+// Notifies the listener of the shard, if any, about a change to the item; the caller must hold the lock.
+func (s *shard) notify(eventType EventType, item *cacheItem) {
+	if s.listener == nil {
+		return
+	}
+	s.listener(Event{Type: eventType, Entry: item.entry()})
+}
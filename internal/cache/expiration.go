@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	sweepSampleSize      = 20   // Number of items sampled per shard in a single sweep round.
+	sweepRepeatThreshold = 0.25 // Fraction of expired samples above which another round is run right away.
+	sweepMaxRounds       = 16   // Upper bound of rounds per shard and tick, to limit the time a shard is locked.
+)
+
+// Periodically removes expired items from all shards of a cache in the background.
+//
+// Similar to the active expiration in Redis, it samples a small number of items per shard
+// and repeats immediately while a large share of the samples turns out to be expired.
+type sweeper struct {
+	mu     sync.Mutex    // Mutex to synchronize starting and stopping the sweeper.
+	stopCh chan struct{} // Closed to signal the sweeper goroutine to stop.
+	doneCh chan struct{} // Closed by the sweeper goroutine once it has stopped.
+	runs   atomic.Uint64 // Number of completed sweeps.
+}
+
+// StartSweeper starts the background removal of expired items, running every `interval`.
+// Calling it on a cache with a running sweeper or with a non-positive interval is a no-op.
+func (c *Cache) StartSweeper(interval time.Duration) {
+	c.sweeper.mu.Lock()
+	defer c.sweeper.mu.Unlock()
+
+	if interval <= 0 || c.sweeper.stopCh != nil {
+		return
+	}
+
+	c.sweeper.stopCh = make(chan struct{})
+	c.sweeper.doneCh = make(chan struct{})
+
+	go c.runSweeper(interval, c.sweeper.stopCh, c.sweeper.doneCh)
+}
+
+// StopSweeper stops the background removal of expired items and waits for the sweeper to exit.
+// Calling it on a cache without a running sweeper is a no-op.
+func (c *Cache) StopSweeper() {
+	c.sweeper.mu.Lock()
+	defer c.sweeper.mu.Unlock()
+
+	if c.sweeper.stopCh == nil {
+		return
+	}
+
+	close(c.sweeper.stopCh)
+	<-c.sweeper.doneCh
+	c.sweeper.stopCh = nil
+	c.sweeper.doneCh = nil
+}
+
+// Sweeps all shards every interval until the stop channel is closed.
+func (c *Cache) runSweeper(interval time.Duration, stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			for _, shard := range c.shards {
+				shard.sweep()
+			}
+			c.sweeper.runs.Add(1)
+		}
+	}
+}
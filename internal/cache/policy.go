@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+)
+
+// EvictionPolicy names the strategy a shard uses to select the item to evict once it is full.
+type EvictionPolicy string
+
+const (
+	LRU     EvictionPolicy = "lru"     // Evicts the least-recently-used item.
+	LFU     EvictionPolicy = "lfu"     // Evicts the least-frequently-used item, ties are broken by recency.
+	FIFO    EvictionPolicy = "fifo"    // Evicts the item that was inserted first, regardless of its usage.
+	TinyLFU EvictionPolicy = "tinylfu" // W-TinyLFU, a small LRU window in front of a frequency-admitted segmented LRU.
+)
+
+// ParseEvictionPolicy converts the name of an eviction policy into an EvictionPolicy.
+// It returns an error if the name does not denote a known policy.
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch policy := EvictionPolicy(name); policy {
+	case LRU, LFU, FIFO, TinyLFU:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy %q", name)
+	}
+}
+
+// Tracks the items of a shard and decides which one to evict next.
+// Implementations are not thread-safe, they are guarded by the mutex of the owning shard.
+type evictionPolicy interface {
+	add(item *cacheItem)    // Registers a newly inserted item.
+	access(item *cacheItem) // Records a read of an item.
+	remove(item *cacheItem) // Unregisters an item that was deleted, replaced, expired or evicted.
+	victim() *cacheItem     // Selects the next item to evict, or nil if there are no items.
+}
+
+// Creates the evictionPolicy of the given type, falling back to LRU for unknown types.
+func newEvictionPolicy(policy EvictionPolicy) evictionPolicy {
+	switch policy {
+	case LFU:
+		return newLFUPolicy()
+	case FIFO:
+		return &fifoPolicy{items: list.New()}
+	case TinyLFU:
+		return newTinyLFUPolicy()
+	default:
+		return &lruPolicy{items: list.New()}
+	}
+}
+
+// Implements the least-recently-used (LRU) eviction policy.
+type lruPolicy struct {
+	items *list.List // Doubly linked list ordered from most to least recently used.
+}
+
+func (p *lruPolicy) add(item *cacheItem) {
+	item.elem = p.items.PushFront(item)
+}
+
+func (p *lruPolicy) access(item *cacheItem) {
+	p.items.MoveToFront(item.elem)
+}
+
+func (p *lruPolicy) remove(item *cacheItem) {
+	p.items.Remove(item.elem)
+}
+
+func (p *lruPolicy) victim() *cacheItem {
+	return back(p.items)
+}
+
+// Implements the first-in-first-out (FIFO) eviction policy.
+type fifoPolicy struct {
+	items *list.List // Doubly linked list ordered from newest to oldest insertion.
+}
+
+func (p *fifoPolicy) add(item *cacheItem) {
+	item.elem = p.items.PushFront(item)
+}
+
+func (p *fifoPolicy) access(item *cacheItem) {}
+
+func (p *fifoPolicy) remove(item *cacheItem) {
+	p.items.Remove(item.elem)
+}
+
+func (p *fifoPolicy) victim() *cacheItem {
+	return back(p.items)
+}
+
+// Implements the least-frequently-used (LFU) eviction policy in constant time.
+//
+// Items are grouped into buckets by their access frequency, each bucket being ordered by recency,
+// so that the victim is the least recently used item of the lowest frequency.
+type lfuPolicy struct {
+	buckets map[int]*list.List // Items grouped by their access frequency.
+	minFreq int                // Lowest frequency with a non-empty bucket, may be stale after removals.
+}
+
+// Creates an empty lfuPolicy.
+func newLFUPolicy() *lfuPolicy {
+	return &lfuPolicy{buckets: make(map[int]*list.List)}
+}
+
+func (p *lfuPolicy) add(item *cacheItem) {
+	item.freq = 1
+	p.push(item)
+	p.minFreq = 1
+}
+
+func (p *lfuPolicy) access(item *cacheItem) {
+	p.remove(item)
+	item.freq++
+	p.push(item)
+}
+
+func (p *lfuPolicy) remove(item *cacheItem) {
+	bucket := p.buckets[item.freq]
+	bucket.Remove(item.elem)
+	if bucket.Len() == 0 {
+		delete(p.buckets, item.freq)
+	}
+}
+
+func (p *lfuPolicy) victim() *cacheItem {
+	if len(p.buckets) == 0 {
+		return nil
+	}
+
+	if _, ok := p.buckets[p.minFreq]; !ok {
+		p.minFreq = 0
+		for freq := range p.buckets {
+			if p.minFreq == 0 || freq < p.minFreq {
+				p.minFreq = freq
+			}
+		}
+	}
+
+	return back(p.buckets[p.minFreq])
+}
+
+// Pushes the item to the front of the bucket matching its frequency.
+func (p *lfuPolicy) push(item *cacheItem) {
+	bucket, ok := p.buckets[item.freq]
+	if !ok {
+		bucket = list.New()
+		p.buckets[item.freq] = bucket
+	}
+	item.elem = bucket.PushFront(item)
+}
+
+// Returns the item at the back of the list, or nil if the list is empty.
+func back(l *list.List) *cacheItem {
+	elem := l.Back()
+	if elem == nil {
+		return nil
+	}
+	return elem.Value.(*cacheItem)
+}
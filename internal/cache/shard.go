@@ -1,39 +1,104 @@
 package cache
 
 import (
-	"container/list"
 	"sync"
-	"time"
 )
 
 // Represents a partition of the cache that stores a subset of cache items.
 type shard struct {
-	mu       sync.RWMutex             // Mutex for synchronizing read and write access to the shard.
-	items    map[string]*list.Element // Map for fast lookup of cache items by key.
-	eviction *list.List               // Doubly linked list to track item usage for LRU eviction.
-	capacity int                      // Maximum number of items the shard can hold before eviction is triggered.
+	mu       sync.RWMutex          // Mutex for synchronizing read and write access to the shard.
+	items    map[string]*cacheItem // Map for fast lookup of cache items by key.
+	policy   evictionPolicy        // Eviction policy tracking item usage to select the items to evict.
+	capacity int                   // Maximum number of items the shard can hold before eviction is triggered.
+	maxBytes int64                 // Maximum memory in bytes the shard can hold before eviction is triggered.
+	used     int64                 // Approximate memory in bytes currently held by the shard.
+	swept    uint64                // Number of expired items removed by the background sweeper.
+	hits     uint64                // Number of lookups that found a live item.
+	misses   uint64                // Number of lookups that found no item, an expired item or a tombstone.
+	evicted  uint64                // Number of items evicted by the eviction policy.
+	expired  uint64                // Number of expired items removed, lazily or by the sweeper.
+	listener Listener              // Listener notified about changes to items, if any.
+}
+
+// Adds an item to the shard and registers it with the eviction policy.
+// Beforehand, items are evicted until both the item-count and the memory limit allow for the new item.
+func (s *shard) add(item *cacheItem) {
+	item.size = itemSize(item.key, item.value, item.contentType)
+	for len(s.items) > 0 && s.exceeds(item.size) {
+		s.evict()
+	}
+
+	s.policy.add(item)
+	s.items[item.key] = item
+	s.used += item.size
+}
+
+// Removes an item from both the eviction policy and the items map, releasing its memory.
+func (s *shard) remove(item *cacheItem) {
+	s.policy.remove(item)
+	delete(s.items, item.key)
+	s.used -= item.size
+}
+
+// Reports whether adding an item of the given size would exceed the item-count or the memory limit.
+// Non-positive limits are treated as unlimited.
+func (s *shard) exceeds(size int64) bool {
+	if s.capacity > 0 && len(s.items) >= s.capacity {
+		return true
+	}
+	return s.maxBytes > 0 && s.used+size > s.maxBytes
 }
 
 // Checks if a cache item has expired based on its TTL (time-to-live).
+// Items without an expiry time never expire.
 //
-// If the item is expired, it is removed from both the eviction list and the items map.
+// If the item is expired, it is removed from both the eviction policy and the items map,
+// and the expiration of entries other than tombstones is reported to the listener.
 // Returns true if the item was evicted, false otherwise.
-func (s *shard) evictTTL(item *cacheItem, elem *list.Element, key string) bool {
-	if time.Now().After(item.expiryTime) {
-		s.eviction.Remove(elem)
-		delete(s.items, key)
+func (s *shard) evictTTL(item *cacheItem) bool {
+	if item.expired() {
+		s.remove(item)
+		s.expired++
+		if !item.tombstone {
+			s.notify(EventExpire, item)
+		}
 		return true
 	}
 	return false
 }
 
-// Evicts the least-recently-used (LRU) item from the shard when the capacity is exceeded.
-// The item at the back of the eviction list (the least recently used) is removed from both the list and the items map.
-func (s *shard) evictLRU() {
-	elem := s.eviction.Back()
-	if elem != nil {
-		s.eviction.Remove(elem)
-		entry := elem.Value.(*listEntry)
-		delete(s.items, entry.key)
+// Evicts the item selected by the eviction policy from the shard when the capacity or the memory limit is exceeded.
+func (s *shard) evict() {
+	if item := s.policy.victim(); item != nil {
+		s.remove(item)
+		s.evicted++
+	}
+}
+
+// Removes expired items from the shard by sampling a small number of items at a time.
+//
+// Go randomizes the iteration order of maps, so ranging over the items map yields a random sample.
+// Another round is started as long as more than a quarter of the sampled items were expired.
+func (s *shard) sweep() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for round := 0; round < sweepMaxRounds; round++ {
+		sampled, expired := 0, 0
+		for _, item := range s.items {
+			if sampled >= sweepSampleSize {
+				break
+			}
+			sampled++
+
+			if s.evictTTL(item) {
+				expired++
+			}
+		}
+		s.swept += uint64(expired)
+
+		if sampled == 0 || float64(expired)/float64(sampled) <= sweepRepeatThreshold {
+			return
+		}
 	}
 }
@@ -0,0 +1,35 @@
+package cache
+
+// Stats holds counters about the usage, eviction and expiration of cache entries.
+type Stats struct {
+	SweepRuns   uint64  // Number of completed sweeps across all shards.
+	SweptItems  uint64  // Number of expired items reclaimed by the sweeper.
+	Hits        uint64  // Number of lookups that found a live entry.
+	Misses      uint64  // Number of lookups that found no entry, an expired entry or a tombstone.
+	Evictions   uint64  // Number of items evicted to make room for other items.
+	Expirations uint64  // Number of expired items removed, either lazily on access or by the sweeper.
+	ShardItems  []int   // Number of items per shard, including tombstones.
+	ShardBytes  []int64 // Approximate memory in bytes held per shard.
+}
+
+// Stats returns the counters of the cache, collected from all shards.
+func (c *Cache) Stats() Stats {
+	stats := Stats{
+		ShardItems: make([]int, len(c.shards)),
+		ShardBytes: make([]int64, len(c.shards)),
+	}
+	for i, shard := range c.shards {
+		shard.mu.Lock()
+		stats.SweptItems += shard.swept
+		stats.Hits += shard.hits
+		stats.Misses += shard.misses
+		stats.Evictions += shard.evicted
+		stats.Expirations += shard.expired
+		stats.ShardItems[i] = len(shard.items)
+		stats.ShardBytes[i] = shard.used
+		shard.mu.Unlock()
+	}
+	stats.SweepRuns = c.sweeper.runs.Load()
+
+	return stats
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"container/list"
+	"hash/fnv"
+)
+
+const (
+	sketchDepth      = 4    // Number of rows in the count-min sketch.
+	sketchWidth      = 4096 // Number of counters per row, must be a power of two.
+	sketchMaxCount   = 15   // Saturation value of a single counter.
+	sketchResetRatio = 10   // Counters are halved after `sketchResetRatio * sketchWidth` increments.
+
+	windowRatio    = 0.01 // Share of items held by the admission window.
+	protectedRatio = 0.8  // Share of the main segment reserved for the protected segment.
+)
+
+// Segments of the W-TinyLFU policy an item can reside in.
+const (
+	windowSegment uint8 = iota
+	probationSegment
+	protectedSegment
+)
+
+// Implements the W-TinyLFU eviction and admission policy, as used by Caffeine.
+//
+// New items enter a small LRU window. Once the window overflows, its oldest item moves into the
+// main segmented LRU (SLRU) and, if the cache is full, competes with the victim of the main segment.
+// Only the item with the higher estimated access frequency stays in the cache. Frequencies are
+// estimated by a count-min sketch that also remembers items which have been evicted already,
+// so that scans of one-off keys cannot flush frequently used items out of the cache.
+type tinyLFUPolicy struct {
+	window    *list.List       // LRU window admitting all new items.
+	probation *list.List       // Main segment holding items that were not accessed since their admission.
+	protected *list.List       // Main segment holding items that were accessed at least once in probation.
+	sketch    *frequencySketch // Approximate access frequencies of recently seen keys.
+}
+
+// Creates an empty tinyLFUPolicy.
+func newTinyLFUPolicy() *tinyLFUPolicy {
+	return &tinyLFUPolicy{
+		window:    list.New(),
+		probation: list.New(),
+		protected: list.New(),
+		sketch:    newFrequencySketch(),
+	}
+}
+
+func (p *tinyLFUPolicy) add(item *cacheItem) {
+	p.sketch.increment(item.key)
+	item.segment = windowSegment
+	item.elem = p.window.PushFront(item)
+}
+
+func (p *tinyLFUPolicy) access(item *cacheItem) {
+	p.sketch.increment(item.key)
+
+	switch item.segment {
+	case windowSegment:
+		p.window.MoveToFront(item.elem)
+	case probationSegment:
+		p.probation.Remove(item.elem)
+		item.segment = protectedSegment
+		item.elem = p.protected.PushFront(item)
+
+		maxProtected := int(protectedRatio * float64(p.probation.Len()+p.protected.Len()))
+		if p.protected.Len() > max(1, maxProtected) {
+			demoted := back(p.protected)
+			p.protected.Remove(demoted.elem)
+			demoted.segment = probationSegment
+			demoted.elem = p.probation.PushFront(demoted)
+		}
+	case protectedSegment:
+		p.protected.MoveToFront(item.elem)
+	}
+}
+
+func (p *tinyLFUPolicy) remove(item *cacheItem) {
+	p.segment(item).Remove(item.elem)
+}
+
+func (p *tinyLFUPolicy) victim() *cacheItem {
+	total := p.window.Len() + p.probation.Len() + p.protected.Len()
+	maxWindow := max(1, int(windowRatio*float64(total)))
+
+	// Items overflowing the window move to the front of probation, the last one of them
+	// being the candidate that has to compete with the victim of the main segment.
+	var candidate *cacheItem
+	for p.window.Len() > maxWindow {
+		candidate = back(p.window)
+		p.window.Remove(candidate.elem)
+		candidate.segment = probationSegment
+		candidate.elem = p.probation.PushFront(candidate)
+	}
+
+	mainVictim := p.mainVictim()
+	if candidate == nil || mainVictim == nil || mainVictim == candidate {
+		if mainVictim == nil {
+			return back(p.window)
+		}
+		return mainVictim
+	}
+
+	if p.sketch.estimate(candidate.key) > p.sketch.estimate(mainVictim.key) {
+		return mainVictim
+	}
+	return candidate
+}
+
+// Returns the victim of the main segment, preferring items in probation over protected ones.
+func (p *tinyLFUPolicy) mainVictim() *cacheItem {
+	if item := back(p.probation); item != nil {
+		return item
+	}
+	return back(p.protected)
+}
+
+// Returns the list of the segment the item resides in.
+func (p *tinyLFUPolicy) segment(item *cacheItem) *list.List {
+	switch item.segment {
+	case probationSegment:
+		return p.probation
+	case protectedSegment:
+		return p.protected
+	default:
+		return p.window
+	}
+}
+
+// A count-min sketch with 4-bit saturating counters, estimating how often a key was seen recently.
+// The counters are periodically halved, so that the estimates adapt to changing access patterns.
+type frequencySketch struct {
+	counters  [sketchDepth][sketchWidth]uint8 // Rows of counters, one hash function per row.
+	additions int                             // Number of increments since the last reset.
+}
+
+// Creates an empty frequencySketch.
+func newFrequencySketch() *frequencySketch {
+	return &frequencySketch{}
+}
+
+// Records an occurrence of the key.
+func (s *frequencySketch) increment(key string) {
+	h1, h2 := sketchHashes(key)
+	for i := 0; i < sketchDepth; i++ {
+		idx := (h1 + uint32(i)*h2) & (sketchWidth - 1)
+		if s.counters[i][idx] < sketchMaxCount {
+			s.counters[i][idx]++
+		}
+	}
+
+	s.additions++
+	if s.additions >= sketchResetRatio*sketchWidth {
+		s.reset()
+	}
+}
+
+// Returns the estimated number of recent occurrences of the key.
+func (s *frequencySketch) estimate(key string) uint8 {
+	h1, h2 := sketchHashes(key)
+	minCount := uint8(sketchMaxCount)
+	for i := 0; i < sketchDepth; i++ {
+		idx := (h1 + uint32(i)*h2) & (sketchWidth - 1)
+		minCount = min(minCount, s.counters[i][idx])
+	}
+	return minCount
+}
+
+// Halves all counters to age the recorded frequencies.
+func (s *frequencySketch) reset() {
+	for i := range s.counters {
+		for j := range s.counters[i] {
+			s.counters[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// Derives the two hashes used for double hashing into the rows of the sketch.
+func sketchHashes(key string) (uint32, uint32) {
+	hsh := fnv.New64a()
+	hsh.Write([]byte(key))
+	sum := hsh.Sum64()
+	return uint32(sum), uint32(sum>>32) | 1
+}
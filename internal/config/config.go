@@ -1,50 +1,181 @@
 package config
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
+	"github.com/marvinlanhenke/go-distributed-cache/internal/aof"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/cache"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/tracing"
 	"google.golang.org/grpc"
 )
 
+// Modes of repairing stale replicas after a quorum read.
+const (
+	ReadRepairOff   = "off"   // Stale replicas are not repaired.
+	ReadRepairAsync = "async" // Stale replicas are repaired in the background, after the read returned.
+	ReadRepairSync  = "sync"  // Stale replicas are repaired before the read returns.
+)
+
+// Upper bound of the depth of the Merkle trees, limiting the number of leaves exchanged between replicas.
+const MaxMerkleDepth = 16
+
 // Config holds the configuration settings for the distributed cache system.
 // It defines parameters such as network settings, cache behavior, and gRPC options.
 type Config struct {
-	Addr           string        // Address on which the gRPC server listens.
-	Peers          []string      // List of peer addresses in the distributed system.
-	NumShards      int           // Number of shards used to partition the cache.
-	Capacity       int           // Maximum number of cache entries across all shards.
-	TTL            time.Duration // Time-to-live (TTL) for cache entries.
-	MaxRecvMsgSize int           // Maximum size of a received gRPC message (in bytes).
-	MaxSendMsgSize int           // Maximum size of a sent gRPC message (in bytes).
-	RateLimit      int           // Rate limit for incoming requests per second.
-	RateLimitBurst int           // Maximum burst size for rate-limited requests.
+	Addr              string               // Address on which the gRPC server listens.
+	Peers             []string             // List of peer addresses in the distributed system.
+	VirtualNodes      int                  // Number of virtual nodes per node of weight one in the hash ring.
+	NodeWeight        int                  // Relative capacity of this node, scaling its number of virtual nodes.
+	NumShards         int                  // Number of shards used to partition the cache.
+	Capacity          int                  // Maximum number of cache entries across all shards.
+	MaxMemoryBytes    int64                // Maximum memory (in bytes) used by cache entries across all shards.
+	EvictionPolicy    cache.EvictionPolicy // Policy selecting the cache entries to evict once a shard is full.
+	ReplicationFactor int                  // Number of replicas per key (N), zero replicates to a majority of the nodes.
+	ReadQuorum        int                  // Number of replicas that must answer a read at the default consistency level (R), zero means all.
+	WriteQuorum       int                  // Number of replicas that must acknowledge a write at the default consistency level (W), zero means all.
+	TTL               time.Duration        // Time-to-live (TTL) for cache entries.
+	SweepInterval     time.Duration        // Interval of the background sweeper removing expired cache entries.
+	MaxHints          int                  // Maximum number of hints stored for unreachable replicas.
+	MaxHintAge        time.Duration        // Maximum age of a hint before it is discarded.
+	ReadRepair        string               // Mode of repairing stale replicas after a quorum read.
+	AntiEntropy       time.Duration        // Interval of the anti-entropy process reconciling replicas, zero disables it.
+	MerkleDepth       int                  // Depth of the Merkle trees exchanged during anti-entropy.
+	SyncRate          int                  // Maximum number of entries per second exchanged during anti-entropy, zero is unlimited.
+	SnapshotPath      string               // Path of the snapshot file restored on startup, empty disables snapshots.
+	SnapshotInterval  time.Duration        // Interval of the periodic snapshots, zero only takes a snapshot on shutdown.
+	AOFPath           string               // Path of the append-only log replayed on startup, empty disables the log.
+	AOFFsync          aof.FsyncPolicy      // Policy deciding when records of the append-only log are synced.
+	AOFRewriteSize    int64                // Minimum size (in bytes) of the append-only log before it is rewritten.
+	MaxRecvMsgSize    int                  // Maximum size of a received gRPC message (in bytes).
+	MaxSendMsgSize    int                  // Maximum size of a sent gRPC message (in bytes).
+	RPCTimeout        time.Duration        // Timeout of requests forwarded to other nodes.
+	HedgePercentile   int                  // Percentile of recent read latencies after which a read is sent to another replica, zero disables hedging.
+	RateLimit         int                  // Rate limit for incoming requests per second.
+	RateLimitBurst    int                  // Maximum burst size for rate-limited requests.
+	ClusterSecret     string               // Secret shared by all nodes, authenticating forwarded requests; empty trusts the address of the forwarding node.
+	MetricsAddr       string               // Address on which the Prometheus metrics are served over HTTP, empty disables them.
+	TracingExporter   tracing.Exporter     // Exporter the OpenTelemetry spans of the node are sent to.
 }
 
 // Creates and initializes a new Config struct by loading configuration values from environment variables.
 func New() (*Config, error) {
 	numShards := getInt("NUM_SHARDS", 1)
+	virtualNodes := getInt("VIRTUAL_NODES", hashring.DefaultVirtualNodes)
+	nodeWeight := getInt("NODE_WEIGHT", 1)
 	capacity := getInt("CAPACITY", 1000)
+	maxMemoryBytes := getInt("MAX_MEMORY_BYTES", 0)
+	replicationFactor := getInt("REPLICATION_FACTOR", 0)
+	readQuorum := getInt("READ_QUORUM", 0)
+	writeQuorum := getInt("WRITE_QUORUM", 0)
 	TTL := getInt("TTL", 3600)
+	sweepInterval := getInt("SWEEP_INTERVAL", 1)
+	maxHints := getInt("MAX_HINTS", 10000)
+	maxHintAge := getInt("MAX_HINT_AGE", 600)
+	antiEntropy := getInt("ANTI_ENTROPY_INTERVAL", 60)
+	merkleDepth := getInt("ANTI_ENTROPY_DEPTH", 10)
+	syncRate := getInt("ANTI_ENTROPY_RATE", 1000)
+	snapshotInterval := getInt("SNAPSHOT_INTERVAL", 300)
+	aofRewriteSize := getInt("AOF_REWRITE_SIZE", 67108864)
 	maxRecvMsgSize := getInt("MAX_RECV_MSG_SIZE", 4194304)
 	maxSendMsgSize := getInt("MAX_SEND_MSG_SIZE", 4194304)
+	rpcTimeout := getInt("RPC_TIMEOUT", 5)
+	hedgePercentile := getInt("HEDGE_PERCENTILE", 0)
 	rateLimit := getInt("RATE_LIMIT", 10)
 	rateLimitBurst := getInt("RATE_LIMIT_BURST", 100)
 
+	evictionPolicy, err := cache.ParseEvictionPolicy(getString("EVICTION_POLICY", string(cache.LRU)))
+	if err != nil {
+		return nil, err
+	}
+
+	aofFsync, err := aof.ParseFsyncPolicy(getString("AOF_FSYNC", string(aof.FsyncEverySec)))
+	if err != nil {
+		return nil, err
+	}
+
+	tracingExporter, err := tracing.ParseExporter(getString("TRACING_EXPORTER", string(tracing.ExporterNone)))
+	if err != nil {
+		return nil, err
+	}
+
+	readRepair := getString("READ_REPAIR", ReadRepairAsync)
+	switch readRepair {
+	case ReadRepairOff, ReadRepairAsync, ReadRepairSync:
+	default:
+		return nil, fmt.Errorf("unknown read repair mode %q", readRepair)
+	}
+
+	if replicationFactor < 0 || readQuorum < 0 || writeQuorum < 0 {
+		return nil, fmt.Errorf("replication factor and quorums must not be negative, instead got N=%d, R=%d and W=%d", replicationFactor, readQuorum, writeQuorum)
+	}
+	if replicationFactor > 0 && max(readQuorum, writeQuorum) > replicationFactor {
+		return nil, fmt.Errorf("quorums must not exceed the replication factor, instead got N=%d, R=%d and W=%d", replicationFactor, readQuorum, writeQuorum)
+	}
+
+	// With a fixed replication factor, reads and writes default to a majority of the replicas.
+	if replicationFactor > 0 {
+		if readQuorum == 0 {
+			readQuorum = replicationFactor/2 + 1
+		}
+		if writeQuorum == 0 {
+			writeQuorum = replicationFactor/2 + 1
+		}
+	}
+
+	if hedgePercentile < 0 || hedgePercentile > 100 {
+		return nil, fmt.Errorf("hedge percentile must be between 0 and 100, instead got %d", hedgePercentile)
+	}
+
+	if merkleDepth < 0 || merkleDepth > MaxMerkleDepth {
+		return nil, fmt.Errorf("merkle depth must be between 0 and %d, instead got %d", MaxMerkleDepth, merkleDepth)
+	}
+
+	snapshotPath := getString("SNAPSHOT_PATH", "")
+	aofPath := getString("AOF_PATH", "")
+	metricsAddr := getString("METRICS_ADDR", ":9090")
+	clusterSecret := getString("CLUSTER_SECRET", "")
+
 	addr := getString("ADDR", "localhost:8080")
 	peersEnv := getString("PEERS", "")
 	peers := strings.Split(peersEnv, ",")
 
 	return &Config{
-		Addr:           addr,
-		Peers:          peers,
-		NumShards:      numShards,
-		Capacity:       capacity,
-		TTL:            time.Duration(TTL) * time.Second,
-		MaxRecvMsgSize: maxRecvMsgSize,
-		MaxSendMsgSize: maxSendMsgSize,
-		RateLimit:      rateLimit,
-		RateLimitBurst: rateLimitBurst,
+		Addr:              addr,
+		Peers:             peers,
+		VirtualNodes:      virtualNodes,
+		NodeWeight:        nodeWeight,
+		NumShards:         numShards,
+		Capacity:          capacity,
+		MaxMemoryBytes:    int64(maxMemoryBytes),
+		EvictionPolicy:    evictionPolicy,
+		ReplicationFactor: replicationFactor,
+		ReadQuorum:        readQuorum,
+		WriteQuorum:       writeQuorum,
+		TTL:               time.Duration(TTL) * time.Second,
+		SweepInterval:     time.Duration(sweepInterval) * time.Second,
+		MaxHints:          maxHints,
+		MaxHintAge:        time.Duration(maxHintAge) * time.Second,
+		ReadRepair:        readRepair,
+		AntiEntropy:       time.Duration(antiEntropy) * time.Second,
+		MerkleDepth:       merkleDepth,
+		SyncRate:          syncRate,
+		SnapshotPath:      snapshotPath,
+		SnapshotInterval:  time.Duration(snapshotInterval) * time.Second,
+		AOFPath:           aofPath,
+		AOFFsync:          aofFsync,
+		AOFRewriteSize:    int64(aofRewriteSize),
+		MaxRecvMsgSize:    maxRecvMsgSize,
+		MaxSendMsgSize:    maxSendMsgSize,
+		RPCTimeout:        time.Duration(rpcTimeout) * time.Second,
+		HedgePercentile:   hedgePercentile,
+		RateLimit:         rateLimit,
+		RateLimitBurst:    rateLimitBurst,
+		ClusterSecret:     clusterSecret,
+		MetricsAddr:       metricsAddr,
+		TracingExporter:   tracingExporter,
 	}, nil
 }
 
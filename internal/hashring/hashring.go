@@ -4,37 +4,80 @@ import (
 	"crypto/sha1"
 	"encoding/binary"
 	"sort"
+	"strconv"
 	"sync"
 )
 
+// Default number of virtual nodes placed on the ring per physical node of weight one.
+const DefaultVirtualNodes = 100
+
 // Represents a node in the hash ring, identified by its unique ID and associated with an address.
 type Node struct {
-	ID   string // Unique identifier of the node.
-	Addr string // Network address of the node.
+	ID     string // Unique identifier of the node.
+	Addr   string // Network address of the node.
+	Weight int    // Relative capacity of the node, scaling its number of virtual nodes; values below one count as one.
 }
 
-// Represents a node in the hash ring, along with its hashed key value.
+// Represents a virtual node in the hash ring, along with its hashed key value.
 type member struct {
-	hash uint32 // Hash of the node's ID.
-	node *Node  // Pointer to the actual node.
+	hash uint32 // Hash of the virtual node's key, derived from the node's ID.
+	node *Node  // Pointer to the actual (physical) node.
 }
 
 // HashRing represents a consistent hash ring used for distributing keys across nodes.
 // It supports adding, removing, and retrieving nodes based on the hash of a key.
+//
+// Each physical node is placed on the ring multiple times as virtual nodes,
+// which spreads the keyspace evenly across nodes and allows weighting heterogeneous nodes.
 type HashRing struct {
-	mu          sync.Mutex // Mutex to ensure thread-safe operations on the ring.
-	members     []member   // Slice of members (nodes) in the hash ring.
-	Replication int        // Number of nodes to replicate each key to.
+	mu           sync.Mutex       // Mutex to ensure thread-safe operations on the ring.
+	members      []member         // Slice of members (virtual nodes) in the hash ring, sorted by hash.
+	nodes        map[string]*Node // Physical nodes in the hash ring, keyed by their ID.
+	virtualNodes int              // Number of virtual nodes per physical node of weight one.
+	factor       int              // Configured replication factor, zero replicates to a majority of the nodes.
+	Replication  int              // Number of nodes to replicate each key to.
+}
+
+// Option configures optional behavior of a `HashRing`.
+type Option func(*HashRing)
+
+// WithVirtualNodes sets the number of virtual nodes per physical node of weight one (default: DefaultVirtualNodes).
+// Values below one are ignored.
+func WithVirtualNodes(n int) Option {
+	return func(hr *HashRing) {
+		if n > 0 {
+			hr.virtualNodes = n
+		}
+	}
+}
+
+// WithReplicationFactor replicates each key to `n` nodes, independent of the size of the ring.
+// While the ring has fewer than `n` nodes, keys are replicated to all of them.
+// Values below one replicate each key to a majority of the nodes (default).
+func WithReplicationFactor(n int) Option {
+	return func(hr *HashRing) {
+		hr.factor = max(0, n)
+	}
 }
 
 // Creates and returns an empty HashRing instance.
-func New() *HashRing {
-	return &HashRing{}
+func New(opts ...Option) *HashRing {
+	hr := &HashRing{
+		nodes:        make(map[string]*Node),
+		virtualNodes: DefaultVirtualNodes,
+	}
+	for _, opt := range opts {
+		opt(hr)
+	}
+	return hr
 }
 
-// Returns the number of members currently in the hash ring.
+// Returns the number of physical nodes currently in the hash ring.
 func (hr *HashRing) Size() int {
-	return len(hr.members)
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	return len(hr.nodes)
 }
 
 // Checks if the hash ring has no members and returns true if empty, false otherwise.
@@ -42,52 +85,119 @@ func (hr *HashRing) IsEmpty() bool {
 	return hr.Size() == 0
 }
 
-// Adds a new node to the hash ring, hashing the node's ID and inserting it into the sorted list of members.
+// Adds a new node to the hash ring, hashing the keys of its virtual nodes and inserting them into the sorted list of members.
+// Adding a node with an ID that is already part of the ring replaces the existing node, e.g. to apply a new weight.
 // The replication factor is updated after the node is added.
 func (hr *HashRing) Add(node *Node) {
 	hr.mu.Lock()
 	defer hr.mu.Unlock()
 
-	hash := hr.hash(node.ID)
-	member := member{hash: hash, node: node}
-	hr.members = append(hr.members, member)
+	hr.remove(node.ID)
+
+	for i := 0; i < hr.virtualNodes*max(1, node.Weight); i++ {
+		hash := hr.hash(node.ID + "#" + strconv.Itoa(i))
+		hr.members = append(hr.members, member{hash: hash, node: node})
+	}
+	hr.nodes[node.ID] = node
 
 	sort.Slice(hr.members, func(i, j int) bool {
 		return hr.members[i].hash < hr.members[j].hash
 	})
 
-	hr.Replication = hr.Size()/2 + 1
+	hr.updateReplication()
 }
 
 // Removes a node from the hash ring by its ID, adjusting the list of members accordingly.
+// The replication factor is updated after the node is removed.
 func (hr *HashRing) Remove(nodeID string) {
 	hr.mu.Lock()
 	defer hr.mu.Unlock()
 
-	for i, member := range hr.members {
-		if member.node.ID == nodeID {
-			hr.members = append(hr.members[:i], hr.members[i+1:]...)
-			break
+	hr.remove(nodeID)
+	hr.updateReplication()
+}
+
+// Recomputes the number of nodes to replicate each key to from the size of the ring, the caller must hold the lock.
+func (hr *HashRing) updateReplication() {
+	if hr.factor > 0 {
+		hr.Replication = min(hr.factor, len(hr.nodes))
+		return
+	}
+	hr.Replication = len(hr.nodes)/2 + 1
+}
+
+// Removes all virtual nodes of the node with the given ID, the caller must hold the lock.
+func (hr *HashRing) remove(nodeID string) {
+	if _, ok := hr.nodes[nodeID]; !ok {
+		return
+	}
+
+	members := hr.members[:0]
+	for _, member := range hr.members {
+		if member.node.ID != nodeID {
+			members = append(members, member)
 		}
 	}
+	hr.members = members
+	delete(hr.nodes, nodeID)
+}
+
+// Nodes returns the physical nodes currently in the hash ring, sorted by their ID.
+func (hr *HashRing) Nodes() []*Node {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	nodes := make([]*Node, 0, len(hr.nodes))
+	for _, node := range hr.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].ID < nodes[j].ID
+	})
+
+	return nodes
+}
+
+// Clone returns a copy of the hash ring, e.g. to compare the ownership of keys before and after a membership change.
+// The copy shares the Node values with the original ring, which must not be modified.
+func (hr *HashRing) Clone() *HashRing {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	clone := &HashRing{
+		members:      make([]member, len(hr.members)),
+		nodes:        make(map[string]*Node, len(hr.nodes)),
+		virtualNodes: hr.virtualNodes,
+		factor:       hr.factor,
+		Replication:  hr.Replication,
+	}
+	copy(clone.members, hr.members)
+	for id, node := range hr.nodes {
+		clone.nodes[id] = node
+	}
+
+	return clone
 }
 
 // Returns a list of nodes that should be responsible for the given key based on its hash.
 // The number of nodes returned is determined by the replication factor. If enough nodes cannot be found, it returns false.
+//
+// The ring is walked clockwise from the key's hash, skipping virtual nodes of physical nodes that were already selected,
+// so that the returned nodes are always distinct physical nodes.
 func (hr *HashRing) GetNodes(key string) ([]*Node, bool) {
-	if hr.IsEmpty() || hr.Replication > hr.Size() {
-		return nil, false
-	}
-
 	hr.mu.Lock()
 	defer hr.mu.Unlock()
 
+	if len(hr.nodes) == 0 || hr.Replication > len(hr.nodes) {
+		return nil, false
+	}
+
 	hash := hr.hash(key)
-	index := sort.Search(hr.Size(), func(i int) bool {
+	index := sort.Search(len(hr.members), func(i int) bool {
 		return hr.members[i].hash >= hash
 	})
 
-	if index == hr.Size() {
+	if index == len(hr.members) {
 		index = 0
 	}
 
@@ -103,7 +213,7 @@ func (hr *HashRing) GetNodes(key string) ([]*Node, bool) {
 		}
 
 		currentIndex++
-		if currentIndex >= hr.Size() {
+		if currentIndex >= len(hr.members) {
 			currentIndex = 0
 		}
 
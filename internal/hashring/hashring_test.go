@@ -1,6 +1,8 @@
 package hashring_test
 
 import (
+	"fmt"
+	"math"
 	"testing"
 
 	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
@@ -42,6 +44,44 @@ func TestHashRingRemove(t *testing.T) {
 	require.Equal(t, 2, hr.Size(), "expected size of %d, instead got %d", 2, hr.Size())
 }
 
+func TestHashRingReplicationFactor(t *testing.T) {
+	hr := hashring.New(hashring.WithReplicationFactor(3))
+
+	hr.Add(&hashring.Node{ID: "node1", Addr: "localhost:8080"})
+	require.Equal(t, 1, hr.Replication, "expected replication to be %d, instead got %d", 1, hr.Replication)
+
+	for i := 2; i <= 20; i++ {
+		hr.Add(&hashring.Node{ID: fmt.Sprintf("node%d", i), Addr: fmt.Sprintf("localhost:%d", 8080+i)})
+	}
+	require.Equal(t, 3, hr.Replication, "expected replication to be %d, instead got %d", 3, hr.Replication)
+
+	nodes, ok := hr.GetNodes("key")
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+	require.Len(t, nodes, 3, "expected len of %d, instead got %d", 3, len(nodes))
+
+	for i := 3; i <= 20; i++ {
+		hr.Remove(fmt.Sprintf("node%d", i))
+	}
+	require.Equal(t, 2, hr.Replication, "expected replication to be %d, instead got %d", 2, hr.Replication)
+}
+
+func TestHashRingRemoveUpdatesReplication(t *testing.T) {
+	hr := hashring.New()
+	hr.Add(&hashring.Node{ID: "node1", Addr: "localhost:8080"})
+	hr.Add(&hashring.Node{ID: "node2", Addr: "localhost:8081"})
+	hr.Add(&hashring.Node{ID: "node3", Addr: "localhost:8082"})
+
+	hr.Remove("node3")
+	require.Equal(t, 2, hr.Replication, "expected replication to be %d, instead got %d", 2, hr.Replication)
+
+	hr.Remove("node2")
+	require.Equal(t, 1, hr.Replication, "expected replication to be %d, instead got %d", 1, hr.Replication)
+
+	nodes, ok := hr.GetNodes("key")
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+	require.Len(t, nodes, 1, "expected len of %d, instead got %d", 1, len(nodes))
+}
+
 func TestHashRingReplicationWithEmptyRing(t *testing.T) {
 	hr := hashring.New()
 
@@ -67,10 +107,12 @@ func TestHashRingReplicationWithDuplicates(t *testing.T) {
 	hr.Add(&hashring.Node{ID: "node1", Addr: "localhost:8080"})
 	hr.Add(&hashring.Node{ID: "node2", Addr: "localhost:8081"})
 	hr.Add(&hashring.Node{ID: "node2", Addr: "localhost:8081"})
+	require.Equal(t, 2, hr.Size(), "expected size of %d, instead got %d", 2, hr.Size())
 
 	nodes, ok := hr.GetNodes("node1")
-	require.False(t, ok, "expected %v, instead got %v", false, ok)
-	require.Nil(t, nodes, "expected nodes to be nil, instead got %v", nodes)
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+	require.Len(t, nodes, 2, "expected len of %d, instead got %d", 2, len(nodes))
+	require.NotEqual(t, nodes[0].ID, nodes[1].ID, "expected distinct physical nodes, instead got %v", nodes)
 }
 
 func TestHashRingWithEqualNodes(t *testing.T) {
@@ -85,9 +127,100 @@ func TestHashRingWithEqualNodes(t *testing.T) {
 	require.Equal(t, hr1, hr2, "expected both hashrings to be equal")
 }
 
+func TestHashRingNodes(t *testing.T) {
+	hr := hashring.New()
+	hr.Add(&hashring.Node{ID: "node2", Addr: "localhost:8081"})
+	hr.Add(&hashring.Node{ID: "node1", Addr: "localhost:8080"})
+
+	nodes := hr.Nodes()
+	require.Len(t, nodes, 2, "expected len of %d, instead got %d", 2, len(nodes))
+	require.Equal(t, "node1", nodes[0].ID, "expected %v, instead got %v", "node1", nodes[0].ID)
+	require.Equal(t, "node2", nodes[1].ID, "expected %v, instead got %v", "node2", nodes[1].ID)
+}
+
+func TestHashRingClone(t *testing.T) {
+	hr := hashring.New()
+	hr.Add(&hashring.Node{ID: "node1", Addr: "localhost:8080"})
+	hr.Add(&hashring.Node{ID: "node2", Addr: "localhost:8081"})
+
+	clone := hr.Clone()
+	require.Equal(t, hr, clone, "expected clone to be equal to the original hashring")
+
+	hr.Add(&hashring.Node{ID: "node3", Addr: "localhost:8082"})
+	require.Equal(t, 2, clone.Size(), "expected size of %d, instead got %d", 2, clone.Size())
+}
+
 func TestHashRingGetNodeWithEmptyRing(t *testing.T) {
 	hr := hashring.New()
 	result, _ := hr.GetNodes("node1")
 
 	require.Nil(t, result, "expected result to be nil, instead got %v", result)
 }
+
+// Computes the share of `numKeys` keys owned by each node, i.e. for which the node is the first replica.
+func ownership(hr *hashring.HashRing, numKeys int) map[string]float64 {
+	counts := make(map[string]float64)
+	for i := 0; i < numKeys; i++ {
+		nodes, _ := hr.GetNodes(fmt.Sprintf("key-%d", i))
+		counts[nodes[0].ID]++
+	}
+	for id := range counts {
+		counts[id] /= float64(numKeys)
+	}
+	return counts
+}
+
+// Computes the largest relative deviation of a node's share from its expected share.
+func skew(shares map[string]float64, expected map[string]float64) float64 {
+	var maxSkew float64
+	for id, share := range expected {
+		maxSkew = math.Max(maxSkew, math.Abs(shares[id]-share)/share)
+	}
+	return maxSkew
+}
+
+func TestHashRingVirtualNodesDistribution(t *testing.T) {
+	expected := map[string]float64{"node1": 1.0 / 3, "node2": 1.0 / 3, "node3": 1.0 / 3}
+
+	single := hashring.New(hashring.WithVirtualNodes(1))
+	virtual := hashring.New()
+	for id := range expected {
+		single.Add(&hashring.Node{ID: id, Addr: id})
+		virtual.Add(&hashring.Node{ID: id, Addr: id})
+	}
+	single.Replication = 1
+	virtual.Replication = 1
+
+	singleSkew := skew(ownership(single, 100000), expected)
+	virtualSkew := skew(ownership(virtual, 100000), expected)
+	t.Logf("max skew with a single virtual node: %.3f, with %d virtual nodes: %.3f", singleSkew, hashring.DefaultVirtualNodes, virtualSkew)
+
+	require.Less(t, virtualSkew, 0.15, "expected skew below %v, instead got %v", 0.15, virtualSkew)
+	require.Less(t, virtualSkew, singleSkew, "expected virtual nodes to reduce skew from %v, instead got %v", singleSkew, virtualSkew)
+}
+
+func TestHashRingWeightedDistribution(t *testing.T) {
+	hr := hashring.New()
+	hr.Add(&hashring.Node{ID: "node1", Addr: "node1", Weight: 1})
+	hr.Add(&hashring.Node{ID: "node2", Addr: "node2", Weight: 1})
+	hr.Add(&hashring.Node{ID: "node3", Addr: "node3", Weight: 2})
+	hr.Replication = 1
+
+	expected := map[string]float64{"node1": 0.25, "node2": 0.25, "node3": 0.5}
+	result := skew(ownership(hr, 100000), expected)
+	require.Less(t, result, 0.15, "expected skew below %v, instead got %v", 0.15, result)
+}
+
+func TestHashRingRemoveVirtualNodes(t *testing.T) {
+	hr := hashring.New()
+	hr.Add(&hashring.Node{ID: "node1", Addr: "localhost:8080"})
+	hr.Add(&hashring.Node{ID: "node2", Addr: "localhost:8081"})
+	hr.Remove("node2")
+	hr.Replication = 1
+
+	for i := 0; i < 1000; i++ {
+		nodes, ok := hr.GetNodes(fmt.Sprintf("key-%d", i))
+		require.True(t, ok, "expected %v, instead got %v", true, ok)
+		require.Equal(t, "node1", nodes[0].ID, "expected %v, instead got %v", "node1", nodes[0].ID)
+	}
+}
@@ -0,0 +1,66 @@
+package hlc
+
+import (
+	"sync"
+	"time"
+)
+
+// Number of low-order bits of a Timestamp holding the logical counter.
+const logicalBits = 16
+
+// Timestamp is a hybrid logical clock timestamp.
+//
+// The upper 48 bits hold the physical time in milliseconds since the unix epoch, the lower 16 bits hold
+// a logical counter that orders events within the same millisecond. Timestamps therefore compare like
+// plain integers, and a timestamp read from a clock is always greater than any timestamp it observed before.
+type Timestamp uint64
+
+// Physical returns the physical component of the timestamp.
+func (ts Timestamp) Physical() time.Time {
+	return time.UnixMilli(int64(ts >> logicalBits))
+}
+
+// Logical returns the logical component of the timestamp.
+func (ts Timestamp) Logical() uint16 {
+	return uint16(ts)
+}
+
+// Clock is a hybrid logical clock (HLC), combining the wall clock with a logical counter.
+//
+// It stays close to the physical time, but unlike the wall clock it never runs backwards and
+// accounts for timestamps received from other nodes, so that causally related writes are always ordered.
+type Clock struct {
+	mu   sync.Mutex       // Mutex to synchronize access to the last timestamp.
+	last Timestamp        // Last timestamp issued or observed by the clock.
+	now  func() time.Time // Source of the physical time.
+}
+
+// New creates a Clock reading the physical time from the wall clock.
+func New() *Clock {
+	return &Clock{now: time.Now}
+}
+
+// Now returns a timestamp that is greater than every timestamp previously issued or observed by the clock.
+func (c *Clock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wall := Timestamp(c.now().UnixMilli()) << logicalBits
+	if wall > c.last {
+		c.last = wall
+	} else {
+		// An overflowing logical counter carries over into the physical component.
+		c.last++
+	}
+
+	return c.last
+}
+
+// Update advances the clock past a timestamp received from another node,
+// so that subsequent timestamps of this clock are ordered after it.
+func (c *Clock) Update(remote Timestamp) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.last = max(c.last, remote)
+}
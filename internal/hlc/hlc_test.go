@@ -0,0 +1,44 @@
+package hlc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockMonotonic(t *testing.T) {
+	wall := time.UnixMilli(1000)
+	clock := &Clock{now: func() time.Time { return wall }}
+
+	ts1 := clock.Now()
+	ts2 := clock.Now()
+	require.Greater(t, ts2, ts1, "expected %v to be greater than %v", ts2, ts1)
+	require.Equal(t, wall, ts2.Physical(), "expected %v, instead got %v", wall, ts2.Physical())
+	require.Equal(t, uint16(1), ts2.Logical(), "expected %v, instead got %v", 1, ts2.Logical())
+
+	// The wall clock runs backwards, the clock does not.
+	wall = time.UnixMilli(500)
+	ts3 := clock.Now()
+	require.Greater(t, ts3, ts2, "expected %v to be greater than %v", ts3, ts2)
+
+	wall = time.UnixMilli(2000)
+	ts4 := clock.Now()
+	require.Equal(t, wall, ts4.Physical(), "expected %v, instead got %v", wall, ts4.Physical())
+	require.Equal(t, uint16(0), ts4.Logical(), "expected %v, instead got %v", 0, ts4.Logical())
+}
+
+func TestClockUpdate(t *testing.T) {
+	clock := &Clock{now: func() time.Time { return time.UnixMilli(1000) }}
+	local := clock.Now()
+
+	remote := Timestamp(5000<<logicalBits | 7)
+	clock.Update(remote)
+	ts := clock.Now()
+	require.Greater(t, ts, remote, "expected %v to be greater than %v", ts, remote)
+	require.Greater(t, ts, local, "expected %v to be greater than %v", ts, local)
+
+	// Timestamps older than the clock do not move it backwards.
+	clock.Update(local)
+	require.Greater(t, clock.Now(), ts, "expected the clock not to move backwards")
+}
@@ -0,0 +1,107 @@
+package merkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Tree is a Merkle tree over a fixed number of leaves, used to detect differences between replicas.
+//
+// Each key is assigned to one of the 2^depth leaves by its hash. A leaf combines the digests of all keys
+// in its bucket with XOR, so that the order in which keys are added does not matter. Inner nodes hash the
+// concatenation of their children, which allows comparing whole key ranges by comparing a single hash.
+type Tree struct {
+	depth int                 // Depth of the tree, the number of leaves is 2^depth.
+	nodes [][sha256.Size]byte // Nodes in heap layout: the root at index 1, the leaves at [2^depth, 2^(depth+1)).
+	dirty bool                // Whether the inner nodes need to be recomputed after leaves changed.
+}
+
+// New creates an empty Tree with 2^depth leaves.
+func New(depth int) *Tree {
+	return &Tree{
+		depth: depth,
+		nodes: make([][sha256.Size]byte, 2<<depth),
+		dirty: true,
+	}
+}
+
+// Depth returns the depth of the tree.
+func (t *Tree) Depth() int {
+	return t.depth
+}
+
+// Add records a key with its content, e.g. the serialized version and value of a cache entry.
+func (t *Tree) Add(key string, content []byte) {
+	hsh := sha256.New()
+	hsh.Write([]byte(key))
+	hsh.Write([]byte{0})
+	hsh.Write(content)
+
+	var digest [sha256.Size]byte
+	hsh.Sum(digest[:0])
+
+	leaf := &t.nodes[t.leafIndex(t.Bucket(key))]
+	for i := range leaf {
+		leaf[i] ^= digest[i]
+	}
+	t.dirty = true
+}
+
+// Bucket returns the leaf (in the range [0, 2^depth)) the key is assigned to.
+func (t *Tree) Bucket(key string) int {
+	sum := sha256.Sum256([]byte(key))
+	return int(binary.BigEndian.Uint32(sum[:4]) >> (32 - t.depth))
+}
+
+// Root returns the hash of the root node, covering all keys of the tree.
+func (t *Tree) Root() []byte {
+	t.build()
+	return bytes.Clone(t.nodes[1][:])
+}
+
+// Leaves returns the hashes of all leaves, ordered by bucket.
+func (t *Tree) Leaves() [][]byte {
+	leaves := make([][]byte, 1<<t.depth)
+	for i := range leaves {
+		leaves[i] = bytes.Clone(t.nodes[t.leafIndex(i)][:])
+	}
+	return leaves
+}
+
+// Diff compares the leaves of the tree with the leaves of another tree of the same depth
+// and returns the buckets that differ.
+func (t *Tree) Diff(leaves [][]byte) ([]int, error) {
+	if len(leaves) != 1<<t.depth {
+		return nil, fmt.Errorf("expected %d leaves, instead got %d", 1<<t.depth, len(leaves))
+	}
+
+	var buckets []int
+	for i, leaf := range leaves {
+		if !bytes.Equal(t.nodes[t.leafIndex(i)][:], leaf) {
+			buckets = append(buckets, i)
+		}
+	}
+	return buckets, nil
+}
+
+// Recomputes the inner nodes bottom-up, if any leaf changed since the last build.
+func (t *Tree) build() {
+	if !t.dirty {
+		return
+	}
+
+	var buf [2 * sha256.Size]byte
+	for i := (1 << t.depth) - 1; i >= 1; i-- {
+		copy(buf[:sha256.Size], t.nodes[2*i][:])
+		copy(buf[sha256.Size:], t.nodes[2*i+1][:])
+		t.nodes[i] = sha256.Sum256(buf[:])
+	}
+	t.dirty = false
+}
+
+// Returns the index of the leaf for the given bucket in the heap layout.
+func (t *Tree) leafIndex(bucket int) int {
+	return 1<<t.depth + bucket
+}
@@ -0,0 +1,48 @@
+package merkle_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/merkle"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerkleTreeOrderIndependent(t *testing.T) {
+	tree1 := merkle.New(4)
+	tree2 := merkle.New(4)
+	for i := 0; i < 100; i++ {
+		tree1.Add(fmt.Sprintf("key-%d", i), []byte("value"))
+		tree2.Add(fmt.Sprintf("key-%d", 99-i), []byte("value"))
+	}
+
+	require.Equal(t, tree1.Root(), tree2.Root(), "expected equal roots for the same keys")
+
+	buckets, err := tree1.Diff(tree2.Leaves())
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Empty(t, buckets, "expected no differing buckets, instead got %v", buckets)
+}
+
+func TestMerkleTreeDiff(t *testing.T) {
+	tree1 := merkle.New(4)
+	tree2 := merkle.New(4)
+	for i := 0; i < 100; i++ {
+		tree1.Add(fmt.Sprintf("key-%d", i), []byte("value"))
+		tree2.Add(fmt.Sprintf("key-%d", i), []byte("value"))
+	}
+	tree2.Add("key-100", []byte("value"))
+
+	require.NotEqual(t, tree1.Root(), tree2.Root(), "expected different roots for different keys")
+
+	buckets, err := tree1.Diff(tree2.Leaves())
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, []int{tree1.Bucket("key-100")}, buckets, "expected %v, instead got %v", []int{tree1.Bucket("key-100")}, buckets)
+}
+
+func TestMerkleTreeDiffWithDifferentDepth(t *testing.T) {
+	tree1 := merkle.New(4)
+	tree2 := merkle.New(5)
+
+	_, err := tree1.Diff(tree2.Leaves())
+	require.Error(t, err, "expected an error, instead got %v", err)
+}
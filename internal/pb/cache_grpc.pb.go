@@ -20,8 +20,20 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	CacheService_Set_FullMethodName = "/v1.cache.CacheService/Set"
-	CacheService_Get_FullMethodName = "/v1.cache.CacheService/Get"
+	CacheService_Set_FullMethodName           = "/v1.cache.CacheService/Set"
+	CacheService_Get_FullMethodName           = "/v1.cache.CacheService/Get"
+	CacheService_Delete_FullMethodName        = "/v1.cache.CacheService/Delete"
+	CacheService_Increment_FullMethodName     = "/v1.cache.CacheService/Increment"
+	CacheService_Decrement_FullMethodName     = "/v1.cache.CacheService/Decrement"
+	CacheService_MultiGet_FullMethodName      = "/v1.cache.CacheService/MultiGet"
+	CacheService_MultiSet_FullMethodName      = "/v1.cache.CacheService/MultiSet"
+	CacheService_CompareAndSet_FullMethodName = "/v1.cache.CacheService/CompareAndSet"
+	CacheService_SetIfAbsent_FullMethodName   = "/v1.cache.CacheService/SetIfAbsent"
+	CacheService_SetIfPresent_FullMethodName  = "/v1.cache.CacheService/SetIfPresent"
+	CacheService_Watch_FullMethodName         = "/v1.cache.CacheService/Watch"
+	CacheService_Transfer_FullMethodName      = "/v1.cache.CacheService/Transfer"
+	CacheService_MerkleTree_FullMethodName    = "/v1.cache.CacheService/MerkleTree"
+	CacheService_SyncLeaves_FullMethodName    = "/v1.cache.CacheService/SyncLeaves"
 )
 
 // CacheServiceClient is the client API for CacheService service.
@@ -30,6 +42,18 @@ const (
 type CacheServiceClient interface {
 	Set(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*empty.Empty, error)
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	Increment(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error)
+	Decrement(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error)
+	MultiGet(ctx context.Context, in *MultiGetRequest, opts ...grpc.CallOption) (*MultiResponse, error)
+	MultiSet(ctx context.Context, in *MultiSetRequest, opts ...grpc.CallOption) (*MultiResponse, error)
+	CompareAndSet(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	SetIfAbsent(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	SetIfPresent(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error)
+	Transfer(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Entry, empty.Empty], error)
+	MerkleTree(ctx context.Context, in *MerkleTreeRequest, opts ...grpc.CallOption) (*MerkleTreeResponse, error)
+	SyncLeaves(ctx context.Context, in *SyncLeavesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Entry], error)
 }
 
 type cacheServiceClient struct {
@@ -60,12 +84,165 @@ func (c *cacheServiceClient) Get(ctx context.Context, in *GetRequest, opts ...gr
 	return out, nil
 }
 
+func (c *cacheServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, CacheService_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) Increment(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IncrementResponse)
+	err := c.cc.Invoke(ctx, CacheService_Increment_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) Decrement(ctx context.Context, in *IncrementRequest, opts ...grpc.CallOption) (*IncrementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(IncrementResponse)
+	err := c.cc.Invoke(ctx, CacheService_Decrement_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) MultiGet(ctx context.Context, in *MultiGetRequest, opts ...grpc.CallOption) (*MultiResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MultiResponse)
+	err := c.cc.Invoke(ctx, CacheService_MultiGet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) MultiSet(ctx context.Context, in *MultiSetRequest, opts ...grpc.CallOption) (*MultiResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MultiResponse)
+	err := c.cc.Invoke(ctx, CacheService_MultiSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) CompareAndSet(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, CacheService_CompareAndSet_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) SetIfAbsent(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, CacheService_SetIfAbsent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) SetIfPresent(ctx context.Context, in *SetRequest, opts ...grpc.CallOption) (*empty.Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(empty.Empty)
+	err := c.cc.Invoke(ctx, CacheService_SetIfPresent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CacheService_ServiceDesc.Streams[0], CacheService_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, WatchEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CacheService_WatchClient = grpc.ServerStreamingClient[WatchEvent]
+
+func (c *cacheServiceClient) Transfer(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Entry, empty.Empty], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CacheService_ServiceDesc.Streams[1], CacheService_Transfer_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Entry, empty.Empty]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CacheService_TransferClient = grpc.ClientStreamingClient[Entry, empty.Empty]
+
+func (c *cacheServiceClient) MerkleTree(ctx context.Context, in *MerkleTreeRequest, opts ...grpc.CallOption) (*MerkleTreeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MerkleTreeResponse)
+	err := c.cc.Invoke(ctx, CacheService_MerkleTree_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cacheServiceClient) SyncLeaves(ctx context.Context, in *SyncLeavesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Entry], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CacheService_ServiceDesc.Streams[2], CacheService_SyncLeaves_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SyncLeavesRequest, Entry]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CacheService_SyncLeavesClient = grpc.ServerStreamingClient[Entry]
+
 // CacheServiceServer is the server API for CacheService service.
 // All implementations must embed UnimplementedCacheServiceServer
 // for forward compatibility.
 type CacheServiceServer interface {
 	Set(context.Context, *SetRequest) (*empty.Empty, error)
 	Get(context.Context, *GetRequest) (*GetResponse, error)
+	Delete(context.Context, *DeleteRequest) (*empty.Empty, error)
+	Increment(context.Context, *IncrementRequest) (*IncrementResponse, error)
+	Decrement(context.Context, *IncrementRequest) (*IncrementResponse, error)
+	MultiGet(context.Context, *MultiGetRequest) (*MultiResponse, error)
+	MultiSet(context.Context, *MultiSetRequest) (*MultiResponse, error)
+	CompareAndSet(context.Context, *SetRequest) (*empty.Empty, error)
+	SetIfAbsent(context.Context, *SetRequest) (*empty.Empty, error)
+	SetIfPresent(context.Context, *SetRequest) (*empty.Empty, error)
+	Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error
+	Transfer(grpc.ClientStreamingServer[Entry, empty.Empty]) error
+	MerkleTree(context.Context, *MerkleTreeRequest) (*MerkleTreeResponse, error)
+	SyncLeaves(*SyncLeavesRequest, grpc.ServerStreamingServer[Entry]) error
 	mustEmbedUnimplementedCacheServiceServer()
 }
 
@@ -82,6 +259,42 @@ func (UnimplementedCacheServiceServer) Set(context.Context, *SetRequest) (*empty
 func (UnimplementedCacheServiceServer) Get(context.Context, *GetRequest) (*GetResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
 }
+func (UnimplementedCacheServiceServer) Delete(context.Context, *DeleteRequest) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedCacheServiceServer) Increment(context.Context, *IncrementRequest) (*IncrementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Increment not implemented")
+}
+func (UnimplementedCacheServiceServer) Decrement(context.Context, *IncrementRequest) (*IncrementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Decrement not implemented")
+}
+func (UnimplementedCacheServiceServer) MultiGet(context.Context, *MultiGetRequest) (*MultiResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MultiGet not implemented")
+}
+func (UnimplementedCacheServiceServer) MultiSet(context.Context, *MultiSetRequest) (*MultiResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MultiSet not implemented")
+}
+func (UnimplementedCacheServiceServer) CompareAndSet(context.Context, *SetRequest) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompareAndSet not implemented")
+}
+func (UnimplementedCacheServiceServer) SetIfAbsent(context.Context, *SetRequest) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetIfAbsent not implemented")
+}
+func (UnimplementedCacheServiceServer) SetIfPresent(context.Context, *SetRequest) (*empty.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetIfPresent not implemented")
+}
+func (UnimplementedCacheServiceServer) Watch(*WatchRequest, grpc.ServerStreamingServer[WatchEvent]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedCacheServiceServer) Transfer(grpc.ClientStreamingServer[Entry, empty.Empty]) error {
+	return status.Errorf(codes.Unimplemented, "method Transfer not implemented")
+}
+func (UnimplementedCacheServiceServer) MerkleTree(context.Context, *MerkleTreeRequest) (*MerkleTreeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MerkleTree not implemented")
+}
+func (UnimplementedCacheServiceServer) SyncLeaves(*SyncLeavesRequest, grpc.ServerStreamingServer[Entry]) error {
+	return status.Errorf(codes.Unimplemented, "method SyncLeaves not implemented")
+}
 func (UnimplementedCacheServiceServer) mustEmbedUnimplementedCacheServiceServer() {}
 func (UnimplementedCacheServiceServer) testEmbeddedByValue()                      {}
 
@@ -139,6 +352,197 @@ func _CacheService_Get_Handler(srv interface{}, ctx context.Context, dec func(in
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CacheService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_Increment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrementRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).Increment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_Increment_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).Increment(ctx, req.(*IncrementRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_Decrement_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(IncrementRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).Decrement(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_Decrement_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).Decrement(ctx, req.(*IncrementRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_MultiGet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MultiGetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).MultiGet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_MultiGet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).MultiGet(ctx, req.(*MultiGetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_MultiSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MultiSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).MultiSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_MultiSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).MultiSet(ctx, req.(*MultiSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_CompareAndSet_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).CompareAndSet(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_CompareAndSet_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).CompareAndSet(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_SetIfAbsent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).SetIfAbsent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_SetIfAbsent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).SetIfAbsent(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_SetIfPresent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).SetIfPresent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_SetIfPresent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).SetIfPresent(ctx, req.(*SetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CacheServiceServer).Watch(m, &grpc.GenericServerStream[WatchRequest, WatchEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CacheService_WatchServer = grpc.ServerStreamingServer[WatchEvent]
+
+func _CacheService_Transfer_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CacheServiceServer).Transfer(&grpc.GenericServerStream[Entry, empty.Empty]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CacheService_TransferServer = grpc.ClientStreamingServer[Entry, empty.Empty]
+
+func _CacheService_MerkleTree_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MerkleTreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CacheServiceServer).MerkleTree(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CacheService_MerkleTree_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CacheServiceServer).MerkleTree(ctx, req.(*MerkleTreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CacheService_SyncLeaves_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SyncLeavesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CacheServiceServer).SyncLeaves(m, &grpc.GenericServerStream[SyncLeavesRequest, Entry]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CacheService_SyncLeavesServer = grpc.ServerStreamingServer[Entry]
+
 // CacheService_ServiceDesc is the grpc.ServiceDesc for CacheService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -154,7 +558,59 @@ var CacheService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Get",
 			Handler:    _CacheService_Get_Handler,
 		},
+		{
+			MethodName: "Delete",
+			Handler:    _CacheService_Delete_Handler,
+		},
+		{
+			MethodName: "Increment",
+			Handler:    _CacheService_Increment_Handler,
+		},
+		{
+			MethodName: "Decrement",
+			Handler:    _CacheService_Decrement_Handler,
+		},
+		{
+			MethodName: "MultiGet",
+			Handler:    _CacheService_MultiGet_Handler,
+		},
+		{
+			MethodName: "MultiSet",
+			Handler:    _CacheService_MultiSet_Handler,
+		},
+		{
+			MethodName: "CompareAndSet",
+			Handler:    _CacheService_CompareAndSet_Handler,
+		},
+		{
+			MethodName: "SetIfAbsent",
+			Handler:    _CacheService_SetIfAbsent_Handler,
+		},
+		{
+			MethodName: "SetIfPresent",
+			Handler:    _CacheService_SetIfPresent_Handler,
+		},
+		{
+			MethodName: "MerkleTree",
+			Handler:    _CacheService_MerkleTree_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _CacheService_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Transfer",
+			Handler:       _CacheService_Transfer_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "SyncLeaves",
+			Handler:       _CacheService_SyncLeaves_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "cache.proto",
 }
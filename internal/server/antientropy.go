@@ -0,0 +1,304 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/config"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/merkle"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Periodically reconciles the entries this node shares with each of its peers in the background.
+//
+// For every peer, both nodes build a Merkle tree over the keys they are both replicas of according to the hash ring.
+// The initiator sends its root hash; if the roots differ, the peer returns its leaves, and only the entries
+// of differing leaves are exchanged in both directions and merged by version, like during a transfer.
+type antiEntropy struct {
+	mu           sync.Mutex    // Mutex to synchronize starting and stopping the anti-entropy process.
+	stopCh       chan struct{} // Closed to signal the anti-entropy goroutine to stop.
+	doneCh       chan struct{} // Closed by the anti-entropy goroutine once it has stopped.
+	interval     time.Duration // Interval between two rounds, zero disables the process.
+	depth        int           // Depth of the Merkle trees.
+	sendLimiter  *rate.Limiter // Limits the number of entries per second this node sends to the peers it syncs with.
+	serveLimiter *rate.Limiter // Limits the number of entries per second this node streams to peers syncing with it.
+	batchSize    int           // Number of entries sent per transfer stream, at most the burst of the send limiter.
+	rounds       atomic.Uint64 // Number of completed rounds.
+	synced       atomic.Uint64 // Number of entries sent to or merged from peers.
+}
+
+// Creates and initializes a new antiEntropy with the given interval, tree depth and rate in entries per second.
+// A non-positive rate does not limit the number of entries exchanged.
+//
+// The rate applies to the entries sent to peers and to the entries streamed to peers syncing with this node
+// separately, so that neither direction starves the other.
+func newAntiEntropy(interval time.Duration, depth, entriesPerSecond int) *antiEntropy {
+	ae := &antiEntropy{
+		interval:     interval,
+		depth:        depth,
+		sendLimiter:  rate.NewLimiter(rate.Inf, 0),
+		serveLimiter: rate.NewLimiter(rate.Inf, 0),
+		batchSize:    transferBatchSize,
+	}
+	if entriesPerSecond > 0 {
+		ae.sendLimiter = rate.NewLimiter(rate.Limit(entriesPerSecond), entriesPerSecond)
+		ae.serveLimiter = rate.NewLimiter(rate.Limit(entriesPerSecond), entriesPerSecond)
+		ae.batchSize = min(transferBatchSize, entriesPerSecond)
+	}
+
+	return ae
+}
+
+// Starts the anti-entropy process in the background.
+// Calling it with a running process or a non-positive interval is a no-op.
+func (cs *cacheServer) startAntiEntropy() {
+	ae := cs.antiEntropy
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+
+	if ae.interval <= 0 || ae.stopCh != nil {
+		return
+	}
+
+	ae.stopCh = make(chan struct{})
+	ae.doneCh = make(chan struct{})
+
+	go cs.runAntiEntropy(ae.stopCh, ae.doneCh)
+}
+
+// Stops the anti-entropy process and waits for it to exit.
+// Calling it without a running process is a no-op.
+func (cs *cacheServer) stopAntiEntropy() {
+	ae := cs.antiEntropy
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+
+	if ae.stopCh == nil {
+		return
+	}
+
+	close(ae.stopCh)
+	<-ae.doneCh
+	ae.stopCh = nil
+	ae.doneCh = nil
+}
+
+// Reconciles the entries with all peers every interval until the stop channel is closed.
+// Closing the stop channel also cancels a reconciliation in progress.
+func (cs *cacheServer) runAntiEntropy(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := time.NewTicker(cs.antiEntropy.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			for _, node := range cs.hashRing.Nodes() {
+				if node.Addr == cs.config.Addr {
+					continue
+				}
+				select {
+				case <-stopCh:
+					return
+				default:
+				}
+				if err := cs.syncReplica(ctx, node.Addr); err != nil {
+					log.Warn().Err(err).Str("addr", node.Addr).Msg("failed to run anti-entropy with peer")
+				}
+			}
+			cs.antiEntropy.rounds.Add(1)
+		}
+	}
+}
+
+// Reconciles the entries shared with the peer at the target address.
+//
+// It compares the Merkle trees of both nodes, fetches the peer's entries of the differing leaves and
+// merges them locally, then sends its own entries of those leaves to the peer over the `Transfer` stream.
+//
+// Since both directions are rate limited, a large difference may take longer than any fixed timeout. Instead,
+// the peer's entries are received as long as the next one arrives within the RPC timeout, and the own entries
+// are sent in batches, each waiting for the send limiter first and bounded by the RPC timeout.
+func (cs *cacheServer) syncReplica(ctx context.Context, target string) error {
+	ae := cs.antiEntropy
+	tree, buckets := cs.sharedEntries(target, ae.depth)
+
+	client, err := cs.connPool.get(target)
+	if err != nil {
+		return err
+	}
+
+	treeCtx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
+	defer cancel()
+
+	resp, err := client.MerkleTree(treeCtx, &pb.MerkleTreeRequest{
+		SourceNode: cs.config.Addr,
+		Depth:      uint32(ae.depth),
+		Root:       tree.Root(),
+	})
+	if err != nil {
+		return err
+	}
+	if resp.InSync {
+		return nil
+	}
+
+	diff, err := tree.Diff(resp.Leaves)
+	if err != nil {
+		return err
+	}
+
+	req := &pb.SyncLeavesRequest{SourceNode: cs.config.Addr, Depth: uint32(ae.depth)}
+	for _, bucket := range diff {
+		req.Buckets = append(req.Buckets, uint32(bucket))
+	}
+
+	streamCtx, cancelStream := context.WithCancel(ctx)
+	defer cancelStream()
+	idle := time.AfterFunc(cs.config.RPCTimeout, cancelStream)
+	defer idle.Stop()
+
+	stream, err := client.SyncLeaves(streamCtx, req)
+	if err != nil {
+		return err
+	}
+
+	merged := 0
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		idle.Reset(cs.config.RPCTimeout)
+		cs.clock.Update(hlc.Timestamp(entry.Version))
+		if cs.cache.Merge(entry) {
+			merged++
+		}
+	}
+
+	var entries []*pb.Entry
+	for _, bucket := range diff {
+		entries = append(entries, buckets[bucket]...)
+	}
+
+	sent := 0
+	for batch := range slices.Chunk(entries, ae.batchSize) {
+		if err := ae.sendLimiter.WaitN(ctx, len(batch)); err != nil {
+			return err
+		}
+		if err := cs.forwardTransfer(ctx, batch, target); err != nil {
+			return err
+		}
+		sent += len(batch)
+		ae.synced.Add(uint64(len(batch)))
+	}
+
+	ae.synced.Add(uint64(merged))
+	log.Info().Str("addr", target).Int("leaves", len(diff)).Int("merged", merged).Int("sent", sent).Msg("reconciled entries with peer")
+
+	return nil
+}
+
+// MerkleTree compares the root hash of the requesting peer with the Merkle tree over the keys both nodes are replicas of.
+// If the roots differ, it returns the leaves of the tree, so that the peer can determine the leaves to sync.
+func (cs *cacheServer) MerkleTree(ctx context.Context, req *pb.MerkleTreeRequest) (*pb.MerkleTreeResponse, error) {
+	if req.Depth > config.MaxMerkleDepth {
+		return nil, status.Errorf(codes.InvalidArgument, "merkle depth must not exceed %d", config.MaxMerkleDepth)
+	}
+
+	tree, _ := cs.sharedEntries(req.SourceNode, int(req.Depth))
+	if string(tree.Root()) == string(req.Root) {
+		return &pb.MerkleTreeResponse{InSync: true}, nil
+	}
+
+	return &pb.MerkleTreeResponse{Leaves: tree.Leaves()}, nil
+}
+
+// SyncLeaves streams the entries of the requested leaves of the Merkle tree shared with the requesting peer.
+// The number of entries sent per second is limited by the configured anti-entropy rate, independently of
+// the entries this node sends to its peers during its own rounds.
+func (cs *cacheServer) SyncLeaves(req *pb.SyncLeavesRequest, stream pb.CacheService_SyncLeavesServer) error {
+	if req.Depth > config.MaxMerkleDepth {
+		return status.Errorf(codes.InvalidArgument, "merkle depth must not exceed %d", config.MaxMerkleDepth)
+	}
+
+	_, buckets := cs.sharedEntries(req.SourceNode, int(req.Depth))
+	sent := 0
+	for _, bucket := range req.Buckets {
+		for _, entry := range buckets[int(bucket)] {
+			if err := cs.antiEntropy.serveLimiter.Wait(stream.Context()); err != nil {
+				return err
+			}
+			if err := stream.Send(entry); err != nil {
+				return err
+			}
+			sent++
+		}
+	}
+	cs.antiEntropy.synced.Add(uint64(sent))
+
+	return nil
+}
+
+// Builds the Merkle tree over all local entries that are replicated to both this node and the peer,
+// and groups these entries by the leaf of the tree they are assigned to.
+func (cs *cacheServer) sharedEntries(peer string, depth int) (*merkle.Tree, map[int][]*pb.Entry) {
+	tree := merkle.New(depth)
+	buckets := make(map[int][]*pb.Entry)
+
+	cs.cache.Range(func(entry *pb.Entry) bool {
+		nodes, ok := cs.hashRing.GetNodes(entry.Key)
+		if !ok || !containsNode(nodes, cs.config.Addr) || !containsNode(nodes, peer) {
+			return true
+		}
+
+		tree.Add(entry.Key, entryDigest(entry))
+		bucket := tree.Bucket(entry.Key)
+		buckets[bucket] = append(buckets[bucket], entry)
+
+		return true
+	})
+
+	return tree, buckets
+}
+
+// Serializes the parts of an entry that must match between replicas: its version, tombstone flag, flags,
+// content type and value. The content type is prefixed with its length, so that it cannot run into the value.
+func entryDigest(entry *pb.Entry) []byte {
+	buf := binary.BigEndian.AppendUint64(nil, entry.Version)
+	if entry.Tombstone {
+		buf = append(buf, 1)
+	} else {
+		buf = append(buf, 0)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, entry.Flags)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(entry.ContentType)))
+	buf = append(buf, entry.ContentType...)
+	return append(buf, entry.Value...)
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/aof"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/cache"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Queue of changes to the local cache waiting to be appended to the log by the background writer, so that
+// the listener of the cache, which runs under the lock of a shard, never waits for the disk.
+type logQueue struct {
+	mu       sync.Mutex    // Mutex to synchronize access to the queue.
+	cond     *sync.Cond    // Signalled when entries are queued or written, or the queue is closed.
+	pending  []*pb.Entry   // Entries waiting to be appended, in the order of the changes.
+	queued   uint64        // Number of entries queued since the log was opened.
+	written  uint64        // Number of queued entries appended to the log, and synced with the `always` policy.
+	failed   uint64        // Number of entries queued up to the end of the last batch that could not be appended.
+	err      error         // Error of the last batch that could not be appended.
+	closed   bool          // Whether the queue is closed, new entries are dropped from then on.
+	syncWait bool          // Whether writes wait until their entries were written, with the `always` policy.
+	doneCh   chan struct{} // Closed by the background writer once it has appended the remaining entries.
+}
+
+// Creates and initializes a new, empty logQueue.
+func newLogQueue(syncWait bool) *logQueue {
+	q := &logQueue{syncWait: syncWait, doneCh: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// Queues the entry to be appended to the log, unless the queue is closed.
+func (q *logQueue) push(entry *pb.Entry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return
+	}
+	q.pending = append(q.pending, entry)
+	q.queued++
+	q.cond.Broadcast()
+}
+
+// Waits for queued entries and removes them from the queue, together with the number of entries queued so far.
+// It returns false once the queue is closed and empty.
+func (q *logQueue) take() ([]*pb.Entry, uint64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.pending) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if len(q.pending) == 0 {
+		return nil, 0, false
+	}
+
+	batch := q.pending
+	q.pending = nil
+	return batch, q.queued, true
+}
+
+// Returns the number of entries queued so far, marking the start of the changes a write is about to make.
+func (q *logQueue) mark() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.queued
+}
+
+// Records that the first `n` queued entries were written, or failed to be written with err, releasing the writes
+// waiting for them.
+func (q *logQueue) done(n uint64, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.written = n
+	if err != nil {
+		q.failed, q.err = n, err
+	}
+	q.cond.Broadcast()
+}
+
+// Waits until all entries queued so far were written, if writes are acknowledged only once they are synced.
+// It returns the error of a batch that could not be appended after the given mark, since it may hold
+// the changes queued since then; a later batch failing as well fails the write conservatively.
+func (q *logQueue) wait(mark uint64) error {
+	if !q.syncWait {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	target := q.queued
+	for q.written < target {
+		q.cond.Wait()
+	}
+	if q.failed > mark {
+		return q.err
+	}
+	return nil
+}
+
+// Closes the queue and waits until the background writer appended the remaining entries.
+func (q *logQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+
+	<-q.doneCh
+}
+
+// Replays the append-only log on top of the entries restored from the snapshot and opens it for appending.
+//
+// Like the snapshot, entries that expired in the meantime are skipped and the hybrid logical clock is advanced past
+// the replayed versions. Records that were only partially written before a crash are discarded. Calling it with the
+// log disabled is a no-op.
+//
+// If the log cannot be replayed, since it is corrupt or of an unsupported version, it is set aside like a corrupt
+// snapshot and a new log is opened in its place, and the error is returned. Any other error leaves the log closed.
+func (cs *cacheServer) openLog() error {
+	path := cs.config.AOFPath
+	if path == "" {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	restored := 0
+	replayed, discarded, err := aof.Replay(path, func(entry *pb.Entry) {
+		if entry.ExpiryTime != 0 && entry.ExpiryTime <= now {
+			return
+		}
+		cs.clock.Update(hlc.Timestamp(entry.Version))
+		if cs.cache.Merge(entry) {
+			restored++
+		}
+	})
+	var replayErr error
+	if errors.Is(err, aof.ErrCorrupt) || errors.Is(err, aof.ErrUnsupportedVersion) {
+		replayErr = fmt.Errorf("failed to replay append-only log: %w", err)
+		if err := setAside(path); err != nil {
+			return errors.Join(replayErr, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to replay append-only log: %w", err)
+	} else {
+		if discarded > 0 {
+			log.Warn().Str("path", path).Int64("bytes", discarded).Msg("discarded incomplete records at the end of the append-only log")
+		}
+		log.Info().Str("path", path).Int("records", replayed).Int("restored", restored).Msg("replayed append-only log")
+	}
+
+	l, err := aof.Open(path, cs.config.AOFFsync)
+	if err != nil {
+		return errors.Join(replayErr, fmt.Errorf("failed to open append-only log: %w", err))
+	}
+	cs.aof = l
+	if replayErr != nil && restored > 0 {
+		// The records restored before the corruption only remain in the log that was set aside.
+		cs.rewriteLog()
+	}
+	cs.aofQueue = newLogQueue(cs.config.AOFFsync == aof.FsyncAlways)
+	go cs.runLogWriter(cs.aofQueue)
+
+	return replayErr
+}
+
+// Moves a file that could not be restored aside, by appending ".corrupt" to its name, so that it is kept for
+// inspection instead of being overwritten by the next snapshot or appended to.
+func setAside(path string) error {
+	if err := os.Rename(path, path+".corrupt"); err != nil {
+		return fmt.Errorf("failed to set aside %q: %w", path, err)
+	}
+	log.Warn().Str("path", path).Str("moved_to", path+".corrupt").Msg("set aside file that could not be restored")
+	return nil
+}
+
+// Queues a change to the local cache to be appended to the append-only log, if enabled.
+// Expirations are not recorded, since replaying the log skips expired entries anyway.
+func (cs *cacheServer) appendLog(event cache.Event) {
+	if cs.aofQueue == nil || event.Type == cache.EventExpire {
+		return
+	}
+	cs.aofQueue.push(event.Entry)
+}
+
+// Returns the mark of the changes to the local cache made from now on, to be passed to awaitLog.
+func (cs *cacheServer) logMark() uint64 {
+	if cs.aofQueue == nil {
+		return 0
+	}
+	return cs.aofQueue.mark()
+}
+
+// Waits until the changes to the local cache made so far are appended to the append-only log and synced,
+// if the log is enabled with the `always` policy, so that a write is acknowledged only once it is durable.
+// It fails if the changes made since the mark may not have been appended.
+func (cs *cacheServer) awaitLog(mark uint64) error {
+	if cs.aofQueue == nil {
+		return nil
+	}
+	if err := cs.aofQueue.wait(mark); err != nil {
+		return status.Errorf(codes.Internal, "failed to append to append-only log: %v", err)
+	}
+	return nil
+}
+
+// Appends the queued changes to the append-only log in batches, syncing each batch at once with the `always`
+// policy, until the queue is closed. It rewrites the log in the background once it grew too large.
+func (cs *cacheServer) runLogWriter(q *logQueue) {
+	defer close(q.doneCh)
+
+	for {
+		batch, n, ok := q.take()
+		if !ok {
+			return
+		}
+		err := cs.aof.AppendBatch(batch)
+		if err != nil {
+			log.Error().Err(err).Int("entries", len(batch)).Msg("failed to append to append-only log")
+		}
+		q.done(n, err)
+
+		if cs.aof.ShouldRewrite(cs.config.AOFRewriteSize) {
+			go cs.rewriteLog()
+		}
+	}
+}
+
+// Compacts the append-only log into the current entries of the local cache.
+func (cs *cacheServer) rewriteLog() {
+	start := time.Now()
+	err := cs.aof.Rewrite(func(fn func(entry *pb.Entry) bool) {
+		cs.cache.Range(fn)
+	})
+	if errors.Is(err, aof.ErrRewriteInProgress) || errors.Is(err, aof.ErrClosed) {
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Str("path", cs.config.AOFPath).Msg("failed to rewrite append-only log")
+		return
+	}
+
+	log.Info().Str("path", cs.config.AOFPath).Int64("bytes", cs.aof.Size()).Dur("duration", time.Since(start)).Msg("rewrote append-only log")
+}
+
+// Appends the queued changes, then syncs and closes the append-only log, if enabled.
+func (cs *cacheServer) closeLog() {
+	if cs.aof == nil {
+		return
+	}
+	cs.aofQueue.close()
+	if err := cs.aof.Close(); err != nil {
+		log.Error().Err(err).Str("path", cs.config.AOFPath).Msg("failed to close append-only log")
+	}
+}
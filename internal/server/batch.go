@@ -0,0 +1,377 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/cache"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MultiGet retrieves multiple keys from the distributed cache, ensuring read quorum among nodes for each key.
+//
+// The keys are grouped by the replicas responsible for them, so that each replica receives a single batched
+// request for all of its keys. The results are returned in the order of the requested keys, each carrying
+// either the entry or the status code and message of the error, like a Get for the key would have returned.
+// It returns once the quorum of every key is decided, without waiting for slower replicas, or with the error of
+// the caller's context, if it goes away before.
+func (cs *cacheServer) MultiGet(ctx context.Context, req *pb.MultiGetRequest) (*pb.MultiResponse, error) {
+	isForwarded := req.SourceNode != ""
+	if isForwarded {
+		return &pb.MultiResponse{Results: cs.lookupAll(req.Keys)}, nil
+	}
+
+	resolved := make(map[string]*pb.KeyResult, len(req.Keys))
+	required := make(map[string]int, len(req.Keys))
+	batches := make(map[string][]string)
+	for _, key := range req.Keys {
+		if _, ok := resolved[key]; ok {
+			continue
+		}
+		nodes, ok := cs.hashRing.GetNodes(key)
+		if !ok {
+			resolved[key] = keyError(key, status.Errorf(codes.NotFound, "no entry for key %q found", key))
+			continue
+		}
+		resolved[key] = nil
+		required[key] = requiredReplicas(req.Consistency, len(nodes), cs.config.ReadQuorum)
+		for _, node := range nodes {
+			batches[node.Addr] = append(batches[node.Addr], key)
+		}
+	}
+
+	fwdCtx, _, cancel := forwardContext(ctx)
+	defer cancel()
+
+	// Each replica sends exactly one batch of results, nil if it could not be reached.
+	type batchReply struct {
+		target  string
+		keys    []string
+		results []*pb.KeyResult
+	}
+	replyCh := make(chan batchReply, len(batches))
+	pending := make(map[string]int, len(resolved))
+	for target, keys := range batches {
+		for _, key := range keys {
+			pending[key]++
+		}
+		go func(target string, keys []string) {
+			if target == cs.config.Addr {
+				replyCh <- batchReply{target: target, keys: keys, results: cs.lookupAll(keys)}
+				return
+			}
+			resp, err := cs.forwardMultiGet(fwdCtx, &pb.MultiGetRequest{Keys: keys, SourceNode: cs.config.Addr}, target)
+			if err != nil {
+				replyCh <- batchReply{target: target, keys: keys}
+				return
+			}
+			replyCh <- batchReply{target: target, keys: keys, results: resp.Results}
+		}(target, keys)
+	}
+
+	// Like a Get, each key is decided once the required replicas answered and agree, or all of its replicas replied.
+	replies := make(map[string][]replicaReply, len(resolved))
+	undecided := len(pending)
+	for undecided > 0 {
+		select {
+		case batch := <-replyCh:
+			for _, result := range batch.results {
+				switch {
+				case result.Response != nil:
+					cs.clock.Update(hlc.Timestamp(result.Response.Version))
+					replies[result.Key] = append(replies[result.Key], replicaReply{addr: batch.target, resp: result.Response})
+				case codes.Code(result.Code) == codes.NotFound:
+					replies[result.Key] = append(replies[result.Key], replicaReply{addr: batch.target})
+				}
+			}
+			for _, key := range batch.keys {
+				if pending[key] == 0 {
+					continue
+				}
+				pending[key]--
+				if pending[key] == 0 || len(replies[key]) >= required[key] && agree(replies[key]) {
+					pending[key] = 0
+					undecided--
+				}
+			}
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	// Reads in flight fail as well once the deadline of the caller expired, which may decide the quorum first.
+	for key, n := range required {
+		if len(replies[key]) < n {
+			if err := callerErr(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for key, result := range resolved {
+		if result != nil {
+			continue
+		}
+		resp, err := cs.resolveRead(ctx, key, replies[key], required[key])
+		if err != nil {
+			resolved[key] = keyError(key, err)
+			continue
+		}
+		resolved[key] = &pb.KeyResult{Key: key, Response: resp}
+	}
+
+	results := make([]*pb.KeyResult, len(req.Keys))
+	for i, key := range req.Keys {
+		results[i] = resolved[key]
+	}
+
+	return &pb.MultiResponse{Results: results}, nil
+}
+
+// MultiSet stores multiple key-value pairs in the distributed cache, ensuring write quorum among nodes for each key.
+//
+// Like MultiGet, the entries are grouped by the replicas responsible for them and sent as a single batched request
+// per replica. The consistency level of the batch applies to every entry. The results are returned in the order
+// of the entries, each carrying the status code and message of the error, if the entry could not be stored.
+// Like Set, it returns once the quorum of every entry is decided, while the remaining batches complete in the
+// background, or with the error of the caller's context, if it goes away before.
+func (cs *cacheServer) MultiSet(ctx context.Context, req *pb.MultiSetRequest) (*pb.MultiResponse, error) {
+	isForwarded := req.SourceNode != ""
+	if isForwarded {
+		results := make([]*pb.KeyResult, len(req.Entries))
+		mark := cs.logMark()
+		for i, entry := range req.Entries {
+			cs.clock.Update(hlc.Timestamp(entry.Version))
+			results[i] = &pb.KeyResult{Key: entry.Key}
+			if err := cs.cache.Set(entry); err != nil {
+				results[i] = keyError(entry.Key, status.Errorf(codes.ResourceExhausted, "failed to set key %q: %v", entry.Key, err))
+			}
+		}
+		if err := cs.awaitLog(mark); err != nil {
+			return nil, err
+		}
+		return &pb.MultiResponse{Results: results}, nil
+	}
+
+	results := make([]*pb.KeyResult, len(req.Entries))
+	replicas := make([][]*hashring.Node, len(req.Entries))
+	batches := make(map[string][]int)
+
+	for i, entry := range req.Entries {
+		if entry.Ttl < 0 {
+			results[i] = keyError(entry.Key, status.Errorf(codes.InvalidArgument, "ttl must not be negative"))
+			continue
+		}
+		if !cs.cache.Fits(entry) {
+			results[i] = keyError(entry.Key, status.Errorf(codes.ResourceExhausted, "failed to set key %q: %v", entry.Key, cache.ErrItemTooLarge))
+			continue
+		}
+		nodes, ok := cs.hashRing.GetNodes(entry.Key)
+		if !ok {
+			results[i] = keyError(entry.Key, status.Errorf(codes.Internal, "not enough nodes available to achieve write quorum"))
+			continue
+		}
+
+		entry.SourceNode = cs.config.Addr
+		entry.Version = uint64(cs.clock.Now())
+		if expiryTime := cs.cache.ExpiryTime(entry); !expiryTime.IsZero() {
+			entry.ExpiryTime = expiryTime.UnixNano()
+		}
+
+		replicas[i] = nodes
+		for _, node := range nodes {
+			batches[node.Addr] = append(batches[node.Addr], i)
+		}
+	}
+
+	fwdCtx, detach, cancel := forwardContext(ctx)
+	defer detach()
+
+	// Each replica sends exactly one batch of results, nil if it could not be reached.
+	type batchReply struct {
+		indices []int
+		results []*pb.KeyResult
+	}
+	var wg sync.WaitGroup
+	replyCh := make(chan batchReply, len(batches))
+	acks := make([]int, len(req.Entries))
+	pending := make([]int, len(req.Entries))
+	for target, indices := range batches {
+		for _, i := range indices {
+			pending[i]++
+		}
+
+		// The local node acknowledges immediately, since the coordinator applies the entries itself.
+		if target == cs.config.Addr {
+			results := make([]*pb.KeyResult, len(indices))
+			for j, i := range indices {
+				results[j] = &pb.KeyResult{Key: req.Entries[i].Key}
+			}
+			replyCh <- batchReply{indices: indices, results: results}
+			continue
+		}
+
+		wg.Add(1)
+		go func(target string, indices []int) {
+			defer wg.Done()
+
+			entries := make([]*pb.SetRequest, len(indices))
+			for j, i := range indices {
+				entries[j] = req.Entries[i]
+			}
+
+			resp, err := cs.forwardMultiSet(fwdCtx, &pb.MultiSetRequest{Entries: entries, SourceNode: cs.config.Addr}, target)
+			if err != nil || len(resp.Results) != len(entries) {
+				for _, entry := range entries {
+					cs.hintSet(entry, target)
+				}
+				replyCh <- batchReply{indices: indices}
+				return
+			}
+			replyCh <- batchReply{indices: indices, results: resp.Results}
+		}(target, indices)
+	}
+
+	// Release the context once the last batch completed, which may be after the quorum of every entry was decided.
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	// Like a Set, each entry is decided once the required replicas acknowledged it, or the quorum cannot be achieved.
+	required := make([]int, len(req.Entries))
+	undecided := 0
+	for i := range req.Entries {
+		if results[i] == nil {
+			required[i] = requiredReplicas(req.Consistency, len(replicas[i]), cs.config.WriteQuorum)
+			undecided++
+		}
+	}
+	for undecided > 0 {
+		select {
+		case batch := <-replyCh:
+			for j, i := range batch.indices {
+				if pending[i] == 0 {
+					continue
+				}
+				pending[i]--
+				if batch.results != nil && codes.Code(batch.results[j].Code) == codes.OK {
+					acks[i]++
+				}
+				if acks[i] >= required[i] || acks[i]+pending[i] < required[i] {
+					pending[i] = 0
+					undecided--
+				}
+			}
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	// Writes in flight fail as well once the deadline of the caller expired, which may decide the quorum first.
+	for i := range req.Entries {
+		if results[i] == nil && acks[i] < required[i] {
+			if err := callerErr(ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	mark := cs.logMark()
+	for i, entry := range req.Entries {
+		if results[i] != nil {
+			continue
+		}
+		if acks[i] < required[i] {
+			cs.metrics.quorumFailed("write")
+			results[i] = keyError(entry.Key, status.Errorf(codes.Internal, "no write quorum achived"))
+			continue
+		}
+		results[i] = &pb.KeyResult{Key: entry.Key}
+		if !containsNode(replicas[i], cs.config.Addr) {
+			continue
+		}
+		if err := cs.cache.Set(entry); err != nil {
+			results[i] = keyError(entry.Key, status.Errorf(codes.ResourceExhausted, "failed to set key %q: %v", entry.Key, err))
+		}
+	}
+	if err := cs.awaitLog(mark); err != nil {
+		return nil, err
+	}
+
+	return &pb.MultiResponse{Results: results}, nil
+}
+
+// Looks up the keys in the local cache, returning a result with the entry, or a NotFound error, per key.
+func (cs *cacheServer) lookupAll(keys []string) []*pb.KeyResult {
+	results := make([]*pb.KeyResult, len(keys))
+	for i, key := range keys {
+		entry, ok := cs.cache.Lookup(key)
+		if !ok {
+			results[i] = keyError(key, status.Errorf(codes.NotFound, "no entry for key %q found", key))
+			continue
+		}
+		results[i] = &pb.KeyResult{Key: key, Response: toGetResponse(entry)}
+	}
+	return results
+}
+
+// Converts the error of an operation on a single key into the result of a batched request.
+func keyError(key string, err error) *pb.KeyResult {
+	st := status.Convert(err)
+	return &pb.KeyResult{Key: key, Code: uint32(st.Code()), Error: st.Message()}
+}
+
+// Forwards a batched MultiGet request to the target node over gRPC.
+// If the request is successful, it returns the response, otherwise, it returns an error.
+func (cs *cacheServer) forwardMultiGet(ctx context.Context, in *pb.MultiGetRequest, target string) (resp *pb.MultiResponse, err error) {
+	log.Info().Str("addr", target).Int("keys", len(in.Keys)).Msg("forwarding multi get request to target node")
+	defer func(start time.Time) { cs.metrics.observeForward("multi_get", target, start, err) }(time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
+	defer cancel()
+
+	client, err := cs.connPool.get(target)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create grpc client while forwarding multi get request")
+		return nil, err
+	}
+
+	resp, err = client.MultiGet(ctx, in)
+	if err != nil {
+		log.Error().Err(err).Str("addr", target).Msg("failed to forward multi get request")
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Forwards a batched MultiSet request to the target node over gRPC.
+// If the request is successful, it returns the response, otherwise, it returns an error.
+func (cs *cacheServer) forwardMultiSet(ctx context.Context, in *pb.MultiSetRequest, target string) (resp *pb.MultiResponse, err error) {
+	log.Info().Str("addr", target).Int("keys", len(in.Entries)).Msg("forwarding multi set request to target node")
+	defer func(start time.Time) { cs.metrics.observeForward("multi_set", target, start, err) }(time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
+	defer cancel()
+
+	client, err := cs.connPool.get(target)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create grpc client while forwarding multi set request")
+		return nil, err
+	}
+
+	resp, err = client.MultiSet(ctx, in)
+	if err != nil {
+		log.Error().Err(err).Str("addr", target).Msg("failed to forward multi set request")
+		return nil, err
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	empty "github.com/golang/protobuf/ptypes/empty"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Number of locks serializing conditional writes on the primary replica, keys are mapped onto them by hash.
+const numKeyLocks = 256
+
+// A fixed set of mutexes serializing conditional writes to the same key on its primary replica,
+// so that two conditional writes cannot both pass their check before either of them was written.
+type keyLocks [numKeyLocks]sync.Mutex
+
+// Returns the mutex guarding the key.
+func (l *keyLocks) get(key string) *sync.Mutex {
+	hsh := fnv.New32a()
+	hsh.Write([]byte(key))
+	return &l[hsh.Sum32()%numKeyLocks]
+}
+
+// CompareAndSet stores the key-value pair only if the current version of the key, as determined by a quorum read,
+// equals `ExpectedVersion`. An expected version of zero requires the key to be absent.
+// If the condition does not hold, it returns a FailedPrecondition error.
+func (cs *cacheServer) CompareAndSet(ctx context.Context, req *pb.SetRequest) (*empty.Empty, error) {
+	return cs.setIf(ctx, req, pb.CacheServiceClient.CompareAndSet, func(current *pb.GetResponse) error {
+		var version uint64
+		if current != nil {
+			version = current.Version
+		}
+		if version != req.ExpectedVersion {
+			return status.Errorf(codes.FailedPrecondition, "version mismatch for key %q: expected %d, instead got %d", req.Key, req.ExpectedVersion, version)
+		}
+		return nil
+	})
+}
+
+// SetIfAbsent stores the key-value pair only if the key does not exist, as determined by a quorum read.
+// If the key exists, it returns a FailedPrecondition error.
+func (cs *cacheServer) SetIfAbsent(ctx context.Context, req *pb.SetRequest) (*empty.Empty, error) {
+	return cs.setIf(ctx, req, pb.CacheServiceClient.SetIfAbsent, func(current *pb.GetResponse) error {
+		if current != nil {
+			return status.Errorf(codes.FailedPrecondition, "key %q already exists", req.Key)
+		}
+		return nil
+	})
+}
+
+// SetIfPresent stores the key-value pair only if the key exists, as determined by a quorum read.
+// If the key does not exist, it returns a FailedPrecondition error.
+func (cs *cacheServer) SetIfPresent(ctx context.Context, req *pb.SetRequest) (*empty.Empty, error) {
+	return cs.setIf(ctx, req, pb.CacheServiceClient.SetIfPresent, func(current *pb.GetResponse) error {
+		if current == nil {
+			return status.Errorf(codes.FailedPrecondition, "no entry for key %q found", req.Key)
+		}
+		return nil
+	})
+}
+
+// Stores the key-value pair like Set, provided the check accepts the current entry of the key.
+//
+// Like Increment, the request is executed by the primary replica of the key and forwarded to it with `forward`
+// if necessary, so that conditional writes to the same key are serialized no matter which node received them.
+// The primary determines the current entry by a quorum read, counting replicas that answered without an entry,
+// and passes it to the check as nil if the key does not exist or was deleted. The check and the write both run
+// under the lock of the key on the primary.
+func (cs *cacheServer) setIf(ctx context.Context, req *pb.SetRequest, forward conditionalForward, check func(current *pb.GetResponse) error) (*empty.Empty, error) {
+	nodes, ok := cs.hashRing.GetNodes(req.Key)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "not enough nodes available to achieve write quorum")
+	}
+
+	primary := nodes[0].Addr
+	if primary != cs.config.Addr {
+		if req.SourceNode != "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "node %q is not the primary replica of key %q", cs.config.Addr, req.Key)
+		}
+		req.SourceNode = cs.config.Addr
+		return cs.forwardConditional(ctx, req, primary, forward)
+	}
+	// The primary coordinates the write like any other node receiving it from a client.
+	req.SourceNode = ""
+
+	mu := cs.keyLocks.get(req.Key)
+	mu.Lock()
+	defer mu.Unlock()
+
+	replies, required, err := cs.readReplicas(ctx, req.Key, req.Consistency, answered)
+	if err != nil {
+		return nil, err
+	}
+	if len(replies) < required {
+		cs.metrics.quorumFailed("read")
+		return nil, status.Errorf(codes.Internal, "not enough nodes available to achieve read quorum")
+	}
+	current := newestReply(replies)
+	if current != nil {
+		// The write must supersede the entry it was checked against, even if its coordinator's clock ran ahead.
+		cs.clock.Update(hlc.Timestamp(current.Version))
+		cs.readRepair(ctx, req.Key, current, replies)
+		if current.Tombstone {
+			current = nil
+		}
+	}
+
+	if err := check(current); err != nil {
+		return nil, err
+	}
+
+	return cs.Set(ctx, req)
+}
+
+// Sends a conditional write, i.e. one of CompareAndSet, SetIfAbsent or SetIfPresent, with the given client.
+type conditionalForward func(client pb.CacheServiceClient, ctx context.Context, in *pb.SetRequest, opts ...grpc.CallOption) (*empty.Empty, error)
+
+// Forwards a conditional write to the primary replica of the key over gRPC.
+// If the request is successful, it returns the response, otherwise, it returns an error.
+func (cs *cacheServer) forwardConditional(ctx context.Context, in *pb.SetRequest, target string, forward conditionalForward) (*empty.Empty, error) {
+	log.Info().Str("addr", target).Msg("forwarding conditional write to primary replica")
+
+	ctx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
+	defer cancel()
+
+	client, err := cs.connPool.get(target)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create grpc client while forwarding conditional write")
+		return nil, status.Errorf(codes.Internal, "failed to forward request")
+	}
+
+	return forward(client, ctx, in)
+}
@@ -20,12 +20,13 @@ type grpcConn struct {
 type grpcConnPool struct {
 	mu    sync.Mutex           // Mutex to synchronize access to the connections map.
 	conns map[string]*grpcConn // Map of server addresses to their corresponding gRPC connections.
+	opts  []grpc.DialOption    // Additional options for new connections, e.g. client interceptors.
 }
 
-// Creates and initializes a new grpcConnPool instance.
+// Creates and initializes a new grpcConnPool instance, applying the given dial options to every new connection.
 // It returns a pointer to the newly created connection pool, ready to manage gRPC connections.
-func newGrpcConnPool() *grpcConnPool {
-	return &grpcConnPool{conns: make(map[string]*grpcConn)}
+func newGrpcConnPool(opts ...grpc.DialOption) *grpcConnPool {
+	return &grpcConnPool{conns: make(map[string]*grpcConn), opts: opts}
 }
 
 // Retrieves an existing gRPC connection to the specified address, or establishes a new one if it doesn't exist.
@@ -41,8 +42,8 @@ func (c *grpcConnPool) get(addr string) (*grpcConn, error) {
 		return conn, nil
 	}
 
-	opts := grpc.WithTransportCredentials(insecure.NewCredentials())
-	cc, err := grpc.NewClient(addr, opts)
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, c.opts...)
+	cc, err := grpc.NewClient(addr, opts...)
 	if err != nil {
 		return nil, err
 	}
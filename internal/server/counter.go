@@ -0,0 +1,214 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/cache"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Increment atomically adds the delta to the counter stored under the key and returns the new value.
+//
+// To serialize concurrent increments, the request is executed by the primary replica of the key, i.e. the first
+// node returned by the hash ring, and forwarded to it if necessary. The primary applies the delta within the lock
+// of the owning shard and replicates the resulting value as a versioned write to the other replicas, ensuring
+// write quorum like Set. The value is applied on the primary even if the write quorum is not achieved.
+//
+// Since a client cannot tell whether a failed increment was applied, it may pass a `request_id` to retry safely:
+// the primary remembers the result of each request ID for a while, and a retry with the same ID replicates and
+// returns that result again instead of applying the delta once more.
+func (cs *cacheServer) Increment(ctx context.Context, req *pb.IncrementRequest) (*pb.IncrementResponse, error) {
+	if req.Ttl < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "ttl must not be negative")
+	}
+
+	nodes, ok := cs.hashRing.GetNodes(req.Key)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "not enough nodes available to achieve write quorum")
+	}
+
+	primary := nodes[0].Addr
+	if primary != cs.config.Addr {
+		if req.SourceNode != "" {
+			return nil, status.Errorf(codes.FailedPrecondition, "node %q is not the primary replica of key %q", cs.config.Addr, req.Key)
+		}
+		req.SourceNode = cs.config.Addr
+		return cs.forwardIncrement(ctx, req, primary)
+	}
+
+	mark := cs.logMark()
+	result, err := cs.applyIncrement(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.awaitLog(mark); err != nil {
+		return nil, err
+	}
+	setReq := result.set
+
+	achieved, err := cs.replicateWrite(ctx, nodes, requiredReplicas(req.Consistency, len(nodes), cs.config.WriteQuorum), func(ctx context.Context, target string) error {
+		err := cs.forwardSet(ctx, setReq, target)
+		if err != nil {
+			cs.hintSet(setReq, target)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !achieved {
+		log.Error().Str("addr", cs.config.Addr).Msg("no write quorum achieved")
+		cs.metrics.quorumFailed("write")
+		if req.RequestId != "" {
+			return nil, status.Errorf(codes.Internal, "no write quorum achieved, the increment was applied on the primary and can be retried with the same request id")
+		}
+		return nil, status.Errorf(codes.Internal, "no write quorum achieved, the increment was applied on the primary")
+	}
+
+	return result.resp, nil
+}
+
+// Applies the increment on the primary and returns the write to replicate together with the response.
+// If the request carries an ID the primary already applied, the remembered result is returned instead.
+func (cs *cacheServer) applyIncrement(req *pb.IncrementRequest) (*incrementResult, error) {
+	if req.RequestId != "" {
+		// Serialize requests to the same key, so that concurrent retries apply the delta only once.
+		mu := cs.keyLocks.get(req.Key)
+		mu.Lock()
+		defer mu.Unlock()
+
+		if result, ok := cs.increments.get(req.Key, req.RequestId); ok {
+			return result, nil
+		}
+	}
+
+	entry, value, err := cs.cache.Increment(req, uint64(cs.clock.Now()))
+	if errors.Is(err, cache.ErrNotInteger) || errors.Is(err, cache.ErrOverflow) {
+		return nil, status.Errorf(codes.FailedPrecondition, "failed to increment key %q: %v", req.Key, err)
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to increment key %q: %v", req.Key, err)
+	}
+	// The version may have been raised past the existing entry, later writes of this node must supersede it.
+	cs.clock.Update(hlc.Timestamp(entry.Version))
+
+	result := &incrementResult{
+		set: &pb.SetRequest{
+			Key:        entry.Key,
+			Value:      entry.Value,
+			SourceNode: cs.config.Addr,
+			ExpiryTime: entry.ExpiryTime,
+			NoExpiry:   entry.ExpiryTime == 0,
+			Version:    entry.Version,
+		},
+		resp:      &pb.IncrementResponse{Value: value, Version: entry.Version},
+		appliedAt: time.Now(),
+	}
+	if req.RequestId != "" && !cs.increments.add(req.Key, req.RequestId, result) {
+		log.Warn().Str("key", req.Key).Msg("increment store full, retries of the request are applied again")
+	}
+
+	return result, nil
+}
+
+// Decrement atomically subtracts the delta from the counter stored under the key and returns the new value.
+// It behaves like Increment with a negated delta.
+func (cs *cacheServer) Decrement(ctx context.Context, req *pb.IncrementRequest) (*pb.IncrementResponse, error) {
+	if req.SourceNode != "" {
+		return nil, status.Errorf(codes.InvalidArgument, "decrements cannot be forwarded")
+	}
+	if req.Delta == math.MinInt64 {
+		return nil, status.Errorf(codes.InvalidArgument, "delta must be greater than %d", int64(math.MinInt64))
+	}
+	req.Delta = -req.Delta
+	return cs.Increment(ctx, req)
+}
+
+// Forwards an Increment request to the primary replica of the key over gRPC.
+// If the request is successful, it returns the response, otherwise, it returns an error.
+func (cs *cacheServer) forwardIncrement(ctx context.Context, in *pb.IncrementRequest, target string) (*pb.IncrementResponse, error) {
+	log.Info().Str("addr", target).Msg("forwarding increment request to primary replica")
+
+	ctx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
+	defer cancel()
+
+	client, err := cs.connPool.get(target)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create grpc client while forwarding increment request")
+		return nil, status.Errorf(codes.Internal, "failed to forward request")
+	}
+
+	return client.Increment(ctx, in)
+}
+
+const (
+	maxIncrementResults = 10000           // Maximum number of results of increments with a request ID kept by the primary.
+	incrementResultAge  = 5 * time.Minute // Time the result of an increment with a request ID is kept for retries.
+)
+
+// Result of an increment applied by the primary replica.
+type incrementResult struct {
+	set       *pb.SetRequest        // Versioned write replicating the new value of the counter.
+	resp      *pb.IncrementResponse // Response returned to the client.
+	appliedAt time.Time             // Time when the increment was applied.
+}
+
+// A bounded store of the results of increments with a request ID, so that retries are not applied twice.
+//
+// Results older than the maximum age are discarded, as are new results once the store is full.
+type incrementStore struct {
+	mu         sync.Mutex                  // Mutex to synchronize access to the results.
+	results    map[string]*incrementResult // Results keyed by the cache key and the request ID.
+	maxResults int                         // Maximum number of results.
+	maxAge     time.Duration               // Maximum age of a result before it is discarded.
+}
+
+// Creates and initializes a new incrementStore with the given bounds.
+func newIncrementStore(maxResults int, maxAge time.Duration) *incrementStore {
+	return &incrementStore{
+		results:    make(map[string]*incrementResult),
+		maxResults: maxResults,
+		maxAge:     maxAge,
+	}
+}
+
+// Returns the result of the increment of the key with the request ID, unless it is unknown or exceeded the maximum age.
+func (s *incrementStore) get(key, requestID string) (*incrementResult, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, ok := s.results[key+"\x00"+requestID]
+	if !ok || time.Since(result.appliedAt) > s.maxAge {
+		return nil, false
+	}
+	return result, true
+}
+
+// Stores the result of the increment of the key with the request ID.
+// It returns false if the result was discarded because the store is full.
+func (s *incrementStore) add(key, requestID string, result *incrementResult) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.results) >= s.maxResults {
+		for id, r := range s.results {
+			if time.Since(r.appliedAt) > s.maxAge {
+				delete(s.results, id)
+			}
+		}
+	}
+	if len(s.results) >= s.maxResults {
+		return false
+	}
+	s.results[key+"\x00"+requestID] = result
+
+	return true
+}
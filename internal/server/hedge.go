@@ -0,0 +1,78 @@
+package server
+
+import (
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	latencyWindow     = 1024 // Number of recent read latencies the hedging threshold is computed from.
+	latencyMinSamples = 32   // Number of latencies required before reads are hedged.
+	latencyRecompute  = 64   // Number of new latencies after which the hedging threshold is computed again.
+)
+
+// Tracks the latencies of recent reads forwarded to replicas, to decide when a read is hedged.
+//
+// Once a quorum read did not complete within the configured percentile of these latencies, it is sent to
+// another replica as well, so that a single slow replica does not dictate the latency of the read.
+type latencyTracker struct {
+	mu         sync.Mutex      // Mutex to synchronize access to the samples.
+	percentile float64         // Percentile of the latencies after which reads are hedged, zero disables hedging.
+	samples    []time.Duration // Ring buffer of recent latencies.
+	next       int             // Index of the sample overwritten next.
+	observed   int             // Number of latencies observed since the threshold was last computed.
+	threshold  time.Duration   // Latency at the percentile, as of the last computation.
+}
+
+// Creates and initializes a new latencyTracker hedging reads after the given percentile of recent latencies.
+// A non-positive percentile disables hedging.
+func newLatencyTracker(percentile int) *latencyTracker {
+	return &latencyTracker{
+		percentile: math.Min(float64(percentile), 100),
+		samples:    make([]time.Duration, 0, latencyWindow),
+	}
+}
+
+// Records the latency of a read forwarded to a replica.
+func (lt *latencyTracker) observe(latency time.Duration) {
+	if lt.percentile <= 0 {
+		return
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if len(lt.samples) < latencyWindow {
+		lt.samples = append(lt.samples, latency)
+	} else {
+		lt.samples[lt.next] = latency
+		lt.next = (lt.next + 1) % latencyWindow
+	}
+	lt.observed++
+}
+
+// Returns the time after which a read is sent to another replica, and false if reads are not hedged,
+// either because hedging is disabled or because too few latencies were observed yet.
+func (lt *latencyTracker) hedgeDelay() (time.Duration, bool) {
+	if lt.percentile <= 0 {
+		return 0, false
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if len(lt.samples) < latencyMinSamples {
+		return 0, false
+	}
+	if lt.threshold == 0 || lt.observed >= latencyRecompute {
+		sorted := slices.Clone(lt.samples)
+		slices.Sort(sorted)
+		i := int(math.Ceil(lt.percentile/100*float64(len(sorted)))) - 1
+		lt.threshold = max(sorted[max(i, 0)], time.Microsecond)
+		lt.observed = 0
+	}
+
+	return lt.threshold, true
+}
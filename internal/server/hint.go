@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+)
+
+// Represents a write that could not be forwarded to an unreachable replica.
+// Exactly one of the requests is set.
+type hint struct {
+	set       *pb.SetRequest    // Set request to replay, if the write was a set.
+	delete    *pb.DeleteRequest // Delete request to replay, if the write was a delete.
+	createdAt time.Time         // Time when the hint was stored.
+}
+
+// A bounded store of hints, kept by the coordinator for replicas that were unreachable during a write.
+//
+// Only the latest write per target node and key is kept, since replaying it alone yields the same state.
+// Hints older than the maximum age are discarded, as are new hints once the store is full.
+type hintStore struct {
+	mu       sync.Mutex                  // Mutex to synchronize access to the hints.
+	hints    map[string]map[string]*hint // Hints keyed by the address of the target node and the cache key.
+	size     int                         // Number of hints across all target nodes.
+	maxHints int                         // Maximum number of hints across all target nodes, zero disables hinted handoff.
+	maxAge   time.Duration               // Maximum age of a hint before it is discarded.
+}
+
+// Creates and initializes a new hintStore with the given bounds.
+func newHintStore(maxHints int, maxAge time.Duration) *hintStore {
+	return &hintStore{
+		hints:    make(map[string]map[string]*hint),
+		maxHints: maxHints,
+		maxAge:   maxAge,
+	}
+}
+
+// Reports whether hinted handoff is enabled.
+func (s *hintStore) enabled() bool {
+	return s.maxHints > 0
+}
+
+// Stores a hint for the key on the target node, replacing any older hint for the same key.
+// It returns false if the hint was discarded because the store is full.
+func (s *hintStore) add(target, key string, h *hint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hints, ok := s.hints[target]
+	if !ok {
+		hints = make(map[string]*hint)
+		s.hints[target] = hints
+	}
+
+	if existing, exists := hints[key]; exists {
+		if existing.createdAt.After(h.createdAt) {
+			return true
+		}
+	} else {
+		if s.size >= s.maxHints {
+			s.prune()
+		}
+		if s.size >= s.maxHints {
+			if len(hints) == 0 {
+				delete(s.hints, target)
+			}
+			return false
+		}
+		s.size++
+	}
+	hints[key] = h
+
+	return true
+}
+
+// Removes and returns all hints for the target node that have not exceeded the maximum age.
+func (s *hintStore) take(target string) map[string]*hint {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	hints := s.hints[target]
+	delete(s.hints, target)
+	s.size -= len(hints)
+
+	for key, h := range hints {
+		if time.Since(h.createdAt) > s.maxAge {
+			delete(hints, key)
+		}
+	}
+
+	return hints
+}
+
+// Returns the number of hints stored for the target node.
+func (s *hintStore) len(target string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.hints[target])
+}
+
+// Discards all hints that exceeded the maximum age, the caller must hold the lock.
+func (s *hintStore) prune() {
+	for target, hints := range s.hints {
+		for key, h := range hints {
+			if time.Since(h.createdAt) > s.maxAge {
+				delete(hints, key)
+				s.size--
+			}
+		}
+		if len(hints) == 0 {
+			delete(s.hints, target)
+		}
+	}
+}
+
+// Stores a hint for a Set request that could not be forwarded to the target node.
+func (cs *cacheServer) hintSet(req *pb.SetRequest, target string) {
+	if cs.hints.enabled() && !cs.hints.add(target, req.Key, &hint{set: req, createdAt: time.Now()}) {
+		log.Warn().Str("addr", target).Str("key", req.Key).Msg("hint store full, dropping hint")
+	}
+}
+
+// Stores a hint for a Delete request that could not be forwarded to the target node.
+func (cs *cacheServer) hintDelete(req *pb.DeleteRequest, target string) {
+	if cs.hints.enabled() && !cs.hints.add(target, req.Key, &hint{delete: req, createdAt: time.Now()}) {
+		log.Warn().Str("addr", target).Str("key", req.Key).Msg("hint store full, dropping hint")
+	}
+}
+
+// Replays the hints stored for the target node, e.g. once it is reported alive again.
+// Hints that still cannot be delivered are stored again for a later attempt.
+func (cs *cacheServer) replayHints(target string) {
+	hints := cs.hints.take(target)
+	if len(hints) == 0 {
+		return
+	}
+
+	replayed := 0
+	for key, h := range hints {
+		var err error
+		if h.set != nil {
+			err = cs.forwardSet(context.Background(), h.set, target)
+		} else {
+			err = cs.forwardDelete(context.Background(), h.delete, target)
+		}
+
+		if err != nil {
+			cs.hints.add(target, key, h)
+			continue
+		}
+		replayed++
+	}
+
+	log.Info().Str("addr", target).Int("replayed", replayed).Int("remaining", len(hints)-replayed).Msg("replayed hints")
+}
@@ -1,6 +1,8 @@
 package server
 
 import (
+	"encoding/json"
+
 	"github.com/hashicorp/memberlist"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/config"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
@@ -13,22 +15,78 @@ type eventDelegate struct {
 }
 
 // NotifyJoin is called when a new node joins the memberlist cluster.
-// It logs the event and adds the node to the hash ring.
+// It logs the event, adds the node to the hash ring, weighted by the weight advertised in its metadata,
+// and hands off the entries the node is now responsible for, including the hints stored for it.
 func (d *eventDelegate) NotifyJoin(node *memberlist.Node) {
 	log.Info().Str("node", node.Name).Msg("Node joined")
-	d.hashRing.Add(&hashring.Node{ID: node.Name, Addr: node.Name})
+	prev := d.hashRing.Clone()
+	d.hashRing.Add(&hashring.Node{ID: node.Name, Addr: node.Name, Weight: decodeNodeMeta(node.Meta).Weight})
+	go d.rebalance(prev)
+	go d.replayHints(node.Name)
 }
 
 // NotifyLeave is called when a node leaves the memberlist cluster.
-// It logs the event and removes the node from the hash ring.
+// It logs the event, removes the node from the hash ring and hands off the entries to the nodes taking over its share.
 func (d *eventDelegate) NotifyLeave(node *memberlist.Node) {
 	log.Info().Str("node", node.Name).Msg("Node left")
+	prev := d.hashRing.Clone()
 	d.hashRing.Remove(node.Name)
+	go d.rebalance(prev)
 }
 
 // NotifyUpdate is called when a node in the memberlist cluster is updated.
-// This implementation does nothing, but it can be extended to handle node updates.
-func (d *eventDelegate) NotifyUpdate(node *memberlist.Node) {}
+// It re-adds the node to the hash ring, so that a changed weight in its metadata takes effect, rebalances accordingly
+// and replays the hints stored for the node.
+func (d *eventDelegate) NotifyUpdate(node *memberlist.Node) {
+	log.Info().Str("node", node.Name).Msg("Node updated")
+	prev := d.hashRing.Clone()
+	d.hashRing.Add(&hashring.Node{ID: node.Name, Addr: node.Name, Weight: decodeNodeMeta(node.Meta).Weight})
+	go d.rebalance(prev)
+	go d.replayHints(node.Name)
+}
+
+// Metadata advertised by each node to the other members of the cluster.
+type nodeMeta struct {
+	Weight int `json:"weight"` // Relative capacity of the node in the hash ring.
+}
+
+// Decodes the metadata advertised by a node, falling back to the zero value if it is missing or malformed.
+func decodeNodeMeta(buf []byte) nodeMeta {
+	var meta nodeMeta
+	if len(buf) == 0 {
+		return meta
+	}
+	if err := json.Unmarshal(buf, &meta); err != nil {
+		log.Warn().Err(err).Msg("Failed to decode node metadata")
+	}
+	return meta
+}
+
+// Implements the memberlist.Delegate interface, advertising the metadata of the local node to the cluster.
+type metaDelegate struct {
+	meta []byte // Encoded metadata of the local node.
+}
+
+// NodeMeta returns the encoded metadata of the local node, limited to `limit` bytes.
+func (d *metaDelegate) NodeMeta(limit int) []byte {
+	if len(d.meta) > limit {
+		log.Warn().Int("limit", limit).Msg("Node metadata exceeds the size limit")
+		return nil
+	}
+	return d.meta
+}
+
+// NotifyMsg is called when a user-data message is received. This implementation does nothing.
+func (d *metaDelegate) NotifyMsg([]byte) {}
+
+// GetBroadcasts is called when user-data messages can be broadcast. This implementation does nothing.
+func (d *metaDelegate) GetBroadcasts(overhead, limit int) [][]byte { return nil }
+
+// LocalState is used for a push/pull sync with a remote node. This implementation does nothing.
+func (d *metaDelegate) LocalState(join bool) []byte { return nil }
+
+// MergeRemoteState is invoked after a push/pull sync with a remote node. This implementation does nothing.
+func (d *metaDelegate) MergeRemoteState(buf []byte, join bool) {}
 
 // Creates and configures a new memberlist for managing the cluster's membership,
 // using the provided cache server and configuration settings.
@@ -40,6 +98,12 @@ func newMemberlist(cs *cacheServer, cfg *config.Config) *memberlist.Memberlist {
 	mlConfig.Name = cfg.Addr
 	mlConfig.Events = &eventDelegate{cs}
 
+	meta, err := json.Marshal(nodeMeta{Weight: cfg.NodeWeight})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Failed to encode node metadata")
+	}
+	mlConfig.Delegate = &metaDelegate{meta: meta}
+
 	ml, err := memberlist.Create(mlConfig)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to create memberlist")
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Prometheus metrics of a cacheServer, kept in a registry of their own so that multiple servers can coexist in tests.
+//
+// Counters maintained elsewhere, like the statistics of the local cache, are read when the metrics are scraped.
+type metrics struct {
+	registry        *prometheus.Registry     // Registry of all metrics of the server.
+	forwardDuration *prometheus.HistogramVec // Latency of requests forwarded to other nodes, by operation and peer.
+	forwardErrors   *prometheus.CounterVec   // Failed requests forwarded to other nodes, by operation and peer.
+	quorumFailures  *prometheus.CounterVec   // Requests that did not achieve their quorum, by read or write.
+	hedgedReads     prometheus.Counter       // Reads sent to an additional replica after the hedging threshold.
+	readMisses      prometheus.Counter       // Quorum reads that achieved their quorum, but found no entry.
+}
+
+// Creates the metrics of the cache server and registers them, together with the collectors reading
+// the statistics of its cache, its hash ring and its background processes, as well as the Go runtime metrics.
+func newMetrics(cs *cacheServer) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		forwardDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "cache_forward_duration_seconds",
+			Help:    "Latency of requests forwarded to other nodes.",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
+		}, []string{"op", "peer"}),
+		forwardErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_forward_errors_total",
+			Help: "Requests forwarded to other nodes that failed.",
+		}, []string{"op", "peer"}),
+		quorumFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "cache_quorum_failures_total",
+			Help: "Requests that did not achieve their read or write quorum.",
+		}, []string{"op"}),
+		hedgedReads: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cache_hedged_reads_total",
+			Help: "Reads sent to an additional replica since the others did not answer within the hedging threshold.",
+		}),
+		readMisses: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "cache_read_misses_total",
+			Help: "Quorum reads that achieved their quorum, but found no entry or a tombstone.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		m.forwardDuration,
+		m.forwardErrors,
+		m.quorumFailures,
+		m.hedgedReads,
+		m.readMisses,
+		&cacheCollector{cs: cs},
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "cache_ring_nodes",
+			Help: "Number of nodes in the hash ring.",
+		}, func() float64 { return float64(len(cs.hashRing.Nodes())) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Name: "cache_read_repairs_total",
+			Help: "Stale replicas repaired after quorum reads.",
+		}, func() float64 { return float64(cs.readRepairs.Load()) }),
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// Records the latency of a request forwarded to the peer and, unless it succeeded, the peer merely reported
+// a missing key, or the request was cancelled since its caller went away or the quorum was already decided,
+// counts it as failed.
+func (m *metrics) observeForward(op, peer string, start time.Time, err error) {
+	m.forwardDuration.WithLabelValues(op, peer).Observe(time.Since(start).Seconds())
+	if code := status.Code(err); code != codes.OK && code != codes.NotFound && code != codes.Canceled {
+		m.forwardErrors.WithLabelValues(op, peer).Inc()
+	}
+}
+
+// Counts a request that did not achieve its quorum, `op` being either "read" or "write".
+func (m *metrics) quorumFailed(op string) {
+	m.quorumFailures.WithLabelValues(op).Inc()
+}
+
+// MetricsHandler returns the HTTP handler exposing the metrics of the cache server in the Prometheus text format.
+func (cs *cacheServer) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(cs.metrics.registry, promhttp.HandlerOpts{})
+}
+
+var (
+	cacheHitsDesc        = prometheus.NewDesc("cache_hits_total", "Lookups that found a live entry.", nil, nil)
+	cacheMissesDesc      = prometheus.NewDesc("cache_misses_total", "Lookups that found no entry, an expired entry or a tombstone.", nil, nil)
+	cacheEvictionsDesc   = prometheus.NewDesc("cache_evictions_total", "Entries evicted to make room for other entries.", nil, nil)
+	cacheExpirationsDesc = prometheus.NewDesc("cache_expirations_total", "Expired entries removed, lazily on access or by the sweeper.", nil, nil)
+	cacheShardItemsDesc  = prometheus.NewDesc("cache_shard_items", "Entries per shard, including tombstones.", []string{"shard"}, nil)
+	cacheShardBytesDesc  = prometheus.NewDesc("cache_shard_bytes", "Approximate memory in bytes held per shard.", []string{"shard"}, nil)
+)
+
+// Collects the statistics of the local cache at scrape time.
+type cacheCollector struct {
+	cs *cacheServer // Server whose cache is collected.
+}
+
+// Describe sends the descriptors of the cache metrics.
+func (c *cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheHitsDesc
+	ch <- cacheMissesDesc
+	ch <- cacheEvictionsDesc
+	ch <- cacheExpirationsDesc
+	ch <- cacheShardItemsDesc
+	ch <- cacheShardBytesDesc
+}
+
+// Collect reads the statistics of the cache and sends them as metrics.
+func (c *cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.cs.cache.Stats()
+
+	ch <- prometheus.MustNewConstMetric(cacheHitsDesc, prometheus.CounterValue, float64(stats.Hits))
+	ch <- prometheus.MustNewConstMetric(cacheMissesDesc, prometheus.CounterValue, float64(stats.Misses))
+	ch <- prometheus.MustNewConstMetric(cacheEvictionsDesc, prometheus.CounterValue, float64(stats.Evictions))
+	ch <- prometheus.MustNewConstMetric(cacheExpirationsDesc, prometheus.CounterValue, float64(stats.Expirations))
+	for i, items := range stats.ShardItems {
+		shard := strconv.Itoa(i)
+		ch <- prometheus.MustNewConstMetric(cacheShardItemsDesc, prometheus.GaugeValue, float64(items), shard)
+		ch <- prometheus.MustNewConstMetric(cacheShardBytesDesc, prometheus.GaugeValue, float64(stats.ShardBytes[i]), shard)
+	}
+}
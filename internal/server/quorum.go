@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
+	"google.golang.org/grpc/status"
+)
+
+// Derives the context of the requests a coordinator forwards to the replicas of a key on behalf of the caller.
+//
+// The forwarded requests share the caller's deadline and values, like its span, and are cancelled when the caller
+// goes away, until `detach` is called: from then on, requests still in flight keep running in the background, e.g.
+// the writes to the replicas beyond the quorum after the coordinator replied. `cancel` releases the context.
+func forwardContext(ctx context.Context) (fwdCtx context.Context, detach func() bool, cancel context.CancelFunc) {
+	fwdCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+	if deadline, ok := ctx.Deadline(); ok {
+		fwdCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+	}
+	return fwdCtx, context.AfterFunc(ctx, cancel), cancel
+}
+
+// Returns the status error of the caller's context once it was cancelled or its deadline passed, and nil otherwise.
+//
+// Since the forwarded requests share the caller's deadline on a timer of their own, see `forwardContext`, they may
+// fail because of it before the caller's context reports the error, so the deadline is compared with the clock.
+func callerErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return status.FromContextError(context.DeadlineExceeded).Err()
+	}
+	return nil
+}
+
+// Sends a write to the replicas of a key and waits until `required` replicas acknowledged it, or until so many
+// replicas failed that the quorum cannot be achieved anymore, and reports whether it was achieved.
+//
+// The local node acknowledges immediately, since the coordinator applies the write itself once the quorum is
+// achieved. Writes to the remaining replicas complete in the background, bounded by the RPC timeout. If the
+// caller goes away before the quorum is decided, the writes in flight are cancelled and the error of the context
+// is returned.
+func (cs *cacheServer) replicateWrite(ctx context.Context, nodes []*hashring.Node, required int, send func(ctx context.Context, target string) error) (bool, error) {
+	fwdCtx, detach, cancel := forwardContext(ctx)
+	defer detach()
+
+	var wg sync.WaitGroup
+	acks := make(chan bool, len(nodes))
+	for _, node := range nodes {
+		if node.Addr == cs.config.Addr {
+			acks <- true
+			continue
+		}
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			acks <- send(fwdCtx, target) == nil
+		}(node.Addr)
+	}
+
+	// Release the context once the last write completed, which may be after the quorum was decided.
+	go func() {
+		wg.Wait()
+		cancel()
+	}()
+
+	acked, pending := 0, len(nodes)
+	for acked < required && acked+pending >= required {
+		select {
+		case ok := <-acks:
+			pending--
+			if ok {
+				acked++
+			}
+		case <-ctx.Done():
+			return false, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	// Writes in flight fail as well once the deadline of the caller expired, which may decide the quorum first.
+	if acked < required {
+		if err := callerErr(ctx); err != nil {
+			return false, err
+		}
+	}
+
+	return acked >= required, nil
+}
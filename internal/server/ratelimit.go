@@ -0,0 +1,270 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"math"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const (
+	sourceNodeHeader    = "x-source-node"    // Metadata key carrying the address of the node forwarding a request.
+	clusterSecretHeader = "x-cluster-secret" // Metadata key carrying the secret shared by the nodes of the cluster.
+	retryAfterHeader    = "retry-after"      // Metadata key carrying the seconds a rate-limited client should wait.
+	clientIdleTime      = 3 * time.Minute    // Time after which the bucket of an idle client is released.
+	peerResolveTTL      = time.Minute        // Time the resolved addresses of a cluster node are cached.
+)
+
+// Limits the rate of incoming requests with a token bucket per client.
+//
+// Clients are identified by the common name of their verified TLS certificate, or by the host of their address.
+// Requests forwarded by other nodes of the cluster are not limited, since they were admitted by the receiving node.
+type rateLimiter struct {
+	mu        sync.Mutex                 // Mutex to synchronize access to the buckets and resolved peers.
+	limit     rate.Limit                 // Number of requests per second and client, zero disables rate limiting.
+	burst     int                        // Maximum burst of requests per client.
+	clients   map[string]*clientBucket   // Token buckets of the clients, by identity.
+	lastPrune time.Time                  // Time idle buckets were last released.
+	peers     map[string]resolvedAddress // Cached addresses of cluster nodes, by node address.
+}
+
+// Token bucket of a single client.
+type clientBucket struct {
+	limiter  *rate.Limiter // Token bucket of the client.
+	lastSeen time.Time     // Time of the last request of the client.
+}
+
+// Resolved IP addresses of a cluster node.
+type resolvedAddress struct {
+	ips     []net.IP  // IP addresses of the node's host.
+	expires time.Time // Time after which the addresses are resolved again.
+}
+
+// Creates and initializes a new rateLimiter allowing `requestsPerSecond` requests with bursts of `burst` per client.
+// A non-positive rate disables rate limiting.
+func newRateLimiter(requestsPerSecond, burst int) *rateLimiter {
+	return &rateLimiter{
+		limit:   rate.Limit(requestsPerSecond),
+		burst:   burst,
+		clients: make(map[string]*clientBucket),
+		peers:   make(map[string]resolvedAddress),
+	}
+}
+
+// Takes a token from the bucket of the client. If none is available, it returns false and the time
+// until the next token becomes available, without consuming it.
+func (rl *rateLimiter) allow(client string) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(rl.lastPrune) > clientIdleTime {
+		for id, bucket := range rl.clients {
+			if now.Sub(bucket.lastSeen) > clientIdleTime {
+				delete(rl.clients, id)
+			}
+		}
+		rl.lastPrune = now
+	}
+
+	bucket, ok := rl.clients[client]
+	if !ok {
+		bucket = &clientBucket{limiter: rate.NewLimiter(rl.limit, rl.burst)}
+		rl.clients[client] = bucket
+	}
+	bucket.lastSeen = now
+
+	reservation := bucket.limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return false, 0
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		return false, delay
+	}
+
+	return true, 0
+}
+
+// Returns the cached IP addresses of the host of a cluster node, resolving them if necessary.
+// An empty host, as in ":8080", denotes the local machine.
+func (rl *rateLimiter) resolve(ctx context.Context, addr string) []net.IP {
+	rl.mu.Lock()
+	resolved, ok := rl.peers[addr]
+	rl.mu.Unlock()
+	if ok && time.Now().Before(resolved.expires) {
+		return resolved.ips
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	rl.mu.Lock()
+	rl.peers[addr] = resolvedAddress{ips: ips, expires: time.Now().Add(peerResolveTTL)}
+	rl.mu.Unlock()
+
+	return ips
+}
+
+// RateLimitUnaryInterceptor returns a unary server interceptor enforcing the configured rate limit per client.
+// Rejected requests fail with ResourceExhausted, carrying the seconds to wait in the `retry-after` header
+// and the exact delay as RetryInfo in the status details.
+func (cs *cacheServer) RateLimitUnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := cs.admit(ctx, func(md metadata.MD) error { return grpc.SetHeader(ctx, md) }); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RateLimitStreamInterceptor returns a stream server interceptor enforcing the configured rate limit per client.
+// Each stream counts as a single request, regardless of the number of messages sent over it.
+func (cs *cacheServer) RateLimitStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := cs.admit(ss.Context(), ss.SetHeader); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+// Decides whether the request of the context is admitted by the rate limiter.
+// If it is rejected, the retry-after header is set with `setHeader` and a ResourceExhausted error is returned.
+func (cs *cacheServer) admit(ctx context.Context, setHeader func(md metadata.MD) error) error {
+	rl := cs.limiter
+	if rl.limit <= 0 || cs.isInternal(ctx) {
+		return nil
+	}
+
+	client := clientIdentity(ctx)
+	ok, delay := rl.allow(client)
+	if ok {
+		return nil
+	}
+
+	st := status.Newf(codes.ResourceExhausted, "rate limit of %v requests per second exceeded for client %q", rl.limit, client)
+	if delay > 0 {
+		retryAfter := int64(math.Ceil(delay.Seconds()))
+		_ = setHeader(metadata.Pairs(retryAfterHeader, strconv.FormatInt(retryAfter, 10)))
+		if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(delay)}); err == nil {
+			st = detailed
+		}
+	}
+
+	return st.Err()
+}
+
+// Reports whether the request was forwarded by another node of the cluster.
+//
+// Forwarding nodes announce their address in the `x-source-node` header. Since clients could send the header as
+// well, the address must belong to a current member of the hash ring. If a cluster secret is configured, the request
+// must carry it in the `x-cluster-secret` header. Otherwise, the request must originate from one of the IP addresses
+// of that member's host, which does not tell apart the member from other clients on the same host.
+func (cs *cacheServer) isInternal(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	sources := md.Get(sourceNodeHeader)
+	if len(sources) != 1 || !containsNode(cs.hashRing.Nodes(), sources[0]) {
+		return false
+	}
+
+	if secret := cs.config.ClusterSecret; secret != "" {
+		secrets := md.Get(clusterSecretHeader)
+		return len(secrets) == 1 && subtle.ConstantTimeCompare([]byte(secrets[0]), []byte(secret)) == 1
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return false
+	}
+	tcpAddr, ok := p.Addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, ip := range cs.limiter.resolve(ctx, sources[0]) {
+		if ip.Equal(tcpAddr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the identity of the client of the request: the common name of its verified TLS certificate, if any,
+// or the host of its address otherwise.
+func clientIdentity(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		if chains := tlsInfo.State.VerifiedChains; len(chains) > 0 && len(chains[0]) > 0 {
+			return "cn:" + chains[0][0].Subject.CommonName
+		}
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// Returns a unary client interceptor announcing the address of the local node, and the cluster secret if any,
+// to the target of forwarded requests.
+func sourceNodeUnaryInterceptor(addr, secret string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(sourceNodeContext(ctx, addr, secret), method, req, reply, cc, opts...)
+	}
+}
+
+// Returns a stream client interceptor announcing the address of the local node, and the cluster secret if any,
+// to the target of forwarded streams.
+func sourceNodeStreamInterceptor(addr, secret string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(sourceNodeContext(ctx, addr, secret), desc, cc, method, opts...)
+	}
+}
+
+// Adds the address of the local node, and the cluster secret unless it is empty, to the outgoing metadata.
+func sourceNodeContext(ctx context.Context, addr, secret string) context.Context {
+	if secret != "" {
+		return metadata.AppendToOutgoingContext(ctx, sourceNodeHeader, addr, clusterSecretHeader, secret)
+	}
+	return metadata.AppendToOutgoingContext(ctx, sourceNodeHeader, addr)
+}
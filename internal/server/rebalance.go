@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"slices"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+)
+
+// Maximum number of entries sent over a single transfer stream, so that each stream completes within the RPC timeout.
+const transferBatchSize = 1000
+
+// Hands off cache entries to their new owners after the membership of the hash ring changed.
+//
+// For every local entry, the replicas responsible before the change (derived from `prev`) are compared
+// with the replicas responsible now. Nodes that gained the entry receive it, including its version,
+// expiry time and tombstone flag, over the internal `Transfer` stream. Once every new owner received
+// the entry, the local copy is dropped if this node lost responsibility for it. Entries are sent in batches of
+// `transferBatchSize`, each over a stream of its own.
+//
+// Rebalancing runs are serialized, since membership changes often arrive in bursts.
+func (cs *cacheServer) rebalance(prev *hashring.HashRing) {
+	cs.rebalanceMu.Lock()
+	defer cs.rebalanceMu.Unlock()
+
+	transfers := make(map[string][]*pb.Entry)
+	var released []*pb.Entry
+
+	cs.cache.Range(func(entry *pb.Entry) bool {
+		prevNodes, ok := prev.GetNodes(entry.Key)
+		if !ok || !containsNode(prevNodes, cs.config.Addr) {
+			return true
+		}
+
+		nodes, ok := cs.hashRing.GetNodes(entry.Key)
+		if !ok {
+			return true
+		}
+
+		for _, node := range nodes {
+			if node.Addr != cs.config.Addr && !containsNode(prevNodes, node.Addr) {
+				transfers[node.Addr] = append(transfers[node.Addr], entry)
+			}
+		}
+		if !containsNode(nodes, cs.config.Addr) {
+			released = append(released, entry)
+		}
+
+		return true
+	})
+
+	failed := make(map[string]struct{})
+	for target, entries := range transfers {
+		for batch := range slices.Chunk(entries, transferBatchSize) {
+			if err := cs.forwardTransfer(context.Background(), batch, target); err != nil {
+				failed[target] = struct{}{}
+				break
+			}
+		}
+		if _, ok := failed[target]; ok {
+			continue
+		}
+		log.Info().Str("addr", target).Int("entries", len(entries)).Msg("handed off entries to new owner")
+	}
+
+	// Keep entries whose new owners did not receive them, so that a later run or a read can still find them.
+	dropped := 0
+	for _, entry := range released {
+		nodes, _ := cs.hashRing.GetNodes(entry.Key)
+		if anyNodeIn(nodes, failed) {
+			continue
+		}
+		if cs.cache.Drop(entry.Key, entry.Version) {
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		log.Info().Str("addr", cs.config.Addr).Int("entries", dropped).Msg("released entries no longer owned")
+	}
+}
+
+// Streams the entries to the target node over gRPC, bounded by the RPC timeout.
+// If all entries were received, it returns nil, otherwise, it returns an error.
+func (cs *cacheServer) forwardTransfer(ctx context.Context, entries []*pb.Entry, target string) error {
+	log.Info().Str("addr", target).Msg("forwarding transfer to target node")
+
+	ctx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
+	defer cancel()
+
+	client, err := cs.connPool.get(target)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create grpc client while forwarding transfer")
+		return err
+	}
+
+	stream, err := client.Transfer(ctx)
+	if err != nil {
+		log.Error().Err(err).Str("addr", target).Msg("failed to open transfer stream")
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := stream.Send(entry); err != nil {
+			log.Error().Err(err).Str("addr", target).Msg("failed to send entry")
+			return err
+		}
+	}
+
+	if _, err := stream.CloseAndRecv(); err != nil {
+		log.Error().Err(err).Str("addr", target).Msg("failed to complete transfer")
+		return err
+	}
+
+	return nil
+}
+
+// Reports whether the node with the given address is part of the list of nodes.
+func containsNode(nodes []*hashring.Node, addr string) bool {
+	for _, node := range nodes {
+		if node.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether any of the nodes is part of the set of addresses.
+func anyNodeIn(nodes []*hashring.Node, addrs map[string]struct{}) bool {
+	for _, node := range nodes {
+		if _, ok := addrs[node.Addr]; ok {
+			return true
+		}
+	}
+	return false
+}
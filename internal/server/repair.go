@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/config"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+)
+
+// Represents the reply of a single replica to a quorum read.
+// A missing response means that the replica answered, but holds no entry for the key.
+type replicaReply struct {
+	addr string          // Address of the replica.
+	resp *pb.GetResponse // Response of the replica, nil if it holds no entry for the key.
+}
+
+// Returns the newest response among the replies, which may be a tombstone, or nil if no replica holds an entry.
+func newestReply(replies []replicaReply) *pb.GetResponse {
+	var newest *pb.GetResponse
+	for _, reply := range replies {
+		if reply.resp != nil && isNewer(reply.resp, newest) {
+			newest = reply.resp
+		}
+	}
+	return newest
+}
+
+// Reports whether all replies agree on the entry of the key, i.e. whether all replicas answered without an entry,
+// or all answered with the same version.
+func agree(replies []replicaReply) bool {
+	for i := 1; i < len(replies); i++ {
+		a, b := replies[0].resp, replies[i].resp
+		if (a == nil) != (b == nil) {
+			return false
+		}
+		if a != nil && (isNewer(a, b) || isNewer(b, a)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pushes the winning response of a quorum read to the replicas that replied with an older version or without an entry.
+//
+// The winner is sent with its version and expiry time through the internal `Transfer` path, so that replicas
+// merge it as-is instead of assigning a version of their own. Depending on the configured mode, the repair runs
+// asynchronously, synchronously before the read returns, or not at all. An asynchronous repair is not cancelled
+// when the read returns.
+func (cs *cacheServer) readRepair(ctx context.Context, key string, winner *pb.GetResponse, replies []replicaReply) {
+	if cs.config.ReadRepair == config.ReadRepairOff {
+		return
+	}
+
+	var stale []string
+	for _, reply := range replies {
+		if reply.resp == nil || isNewer(winner, reply.resp) {
+			stale = append(stale, reply.addr)
+		}
+	}
+	if len(stale) == 0 {
+		return
+	}
+
+	entry := &pb.Entry{
+		Key:         key,
+		Value:       winner.Value,
+		Version:     winner.Version,
+		ExpiryTime:  winner.ExpiryTime,
+		Tombstone:   winner.Tombstone,
+		ContentType: winner.ContentType,
+		Flags:       winner.Flags,
+	}
+
+	repair := func(ctx context.Context) {
+		for _, addr := range stale {
+			if addr == cs.config.Addr {
+				cs.clock.Update(hlc.Timestamp(entry.Version))
+				cs.cache.Merge(entry)
+			} else if err := cs.forwardTransfer(ctx, []*pb.Entry{entry}, addr); err != nil {
+				continue
+			}
+			cs.readRepairs.Add(1)
+			log.Debug().Str("addr", addr).Str("key", key).Msg("repaired stale replica")
+		}
+	}
+
+	if cs.config.ReadRepair == config.ReadRepairSync {
+		repair(ctx)
+		return
+	}
+	go repair(context.WithoutCancel(ctx))
+}
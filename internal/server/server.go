@@ -2,18 +2,23 @@ package server
 
 import (
 	"context"
+	"io"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	empty "github.com/golang/protobuf/ptypes/empty"
 	"github.com/hashicorp/memberlist"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/aof"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/cache"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/config"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
 	"github.com/rs/zerolog/log"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -27,145 +32,425 @@ type cacheServer struct {
 	memberlist                         *memberlist.Memberlist // Memberlist for managing cluster membership.
 	connPool                           *grpcConnPool          // Connection pool for managing gRPC client connections.
 	config                             *config.Config         // Configuration settings for the server.
-	limiter                            *rate.Limiter          // Rate limiter for controlling request throughput.
+	clock                              *hlc.Clock             // Hybrid logical clock assigning the versions of coordinated writes.
+	limiter                            *rateLimiter           // Rate limiter for controlling request throughput per client.
+	rebalanceMu                        sync.Mutex             // Mutex to serialize rebalancing runs after membership changes.
+	keyLocks                           keyLocks               // Mutexes to serialize conditional writes and increments with a request ID to the same key.
+	hints                              *hintStore             // Hints for writes that could not be forwarded to unreachable replicas.
+	readRepairs                        atomic.Uint64          // Number of stale replicas repaired after quorum reads.
+	antiEntropy                        *antiEntropy           // Background process reconciling the entries shared with peers.
+	watchers                           *watchHub              // Watchers of changes to entries of the local cache.
+	snapshots                          *snapshotter           // Background process writing snapshots of the local cache.
+	aof                                *aof.Log               // Append-only log of the changes to the local cache, nil if disabled.
+	aofQueue                           *logQueue              // Changes waiting to be appended to the log, nil if disabled.
+	metrics                            *metrics               // Prometheus metrics of the server.
+	readLatency                        *latencyTracker        // Latencies of recent reads forwarded to replicas, deciding when reads are hedged.
+	increments                         *incrementStore        // Results of recent increments with a request ID, applied by this node as primary.
 }
 
 // Creates and initializes a new cacheServer with the given configuration.
 // It sets up the local cache, hash ring, connection pool, and memberlist, and adds the local node to the hash ring.
+// The local cache is restored from the latest snapshot and the append-only log, if any, before the node joins the cluster.
+// Since the peers hand off entries to the node as soon as it joined, the caller has to listen on the configured address
+// before creating the server.
+// The background sweeper for expired cache entries, the anti-entropy process and the periodic snapshots are started
+// as well and stopped again by `Close`.
 func New(cfg *config.Config) *cacheServer {
 	cs := &cacheServer{
-		cache:    cache.New(cfg.NumShards, cfg.Capacity, cfg.TTL),
-		hashRing: hashring.New(),
-		connPool: newGrpcConnPool(),
-		config:   cfg,
-		limiter:  rate.NewLimiter(rate.Limit(cfg.RateLimit), cfg.RateLimitBurst),
+		hashRing: hashring.New(
+			hashring.WithVirtualNodes(cfg.VirtualNodes),
+			hashring.WithReplicationFactor(cfg.ReplicationFactor),
+		),
+		connPool: newGrpcConnPool(
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+			grpc.WithChainUnaryInterceptor(sourceNodeUnaryInterceptor(cfg.Addr, cfg.ClusterSecret)),
+			grpc.WithChainStreamInterceptor(sourceNodeStreamInterceptor(cfg.Addr, cfg.ClusterSecret)),
+		),
+		config:      cfg,
+		clock:       hlc.New(),
+		limiter:     newRateLimiter(cfg.RateLimit, cfg.RateLimitBurst),
+		hints:       newHintStore(cfg.MaxHints, cfg.MaxHintAge),
+		antiEntropy: newAntiEntropy(cfg.AntiEntropy, cfg.MerkleDepth, cfg.SyncRate),
+		watchers:    newWatchHub(),
+		snapshots:   newSnapshotter(cfg.SnapshotPath, cfg.SnapshotInterval),
+		readLatency: newLatencyTracker(cfg.HedgePercentile),
+		increments:  newIncrementStore(maxIncrementResults, incrementResultAge),
 	}
+	cs.cache = cache.New(cfg.NumShards, cfg.Capacity, cfg.TTL,
+		cache.WithMaxMemory(cfg.MaxMemoryBytes),
+		cache.WithEvictionPolicy(cfg.EvictionPolicy),
+		cache.WithListener(cs.onChange),
+	)
+	cs.metrics = newMetrics(cs)
+	// A node that cannot restore its local state starts without it, since it is recovered from the other replicas.
+	if err := cs.loadSnapshot(); err != nil {
+		log.Error().Err(err).Str("path", cfg.SnapshotPath).Msg("failed to restore snapshot, starting without it")
+	}
+	if err := cs.openLog(); err != nil {
+		log.Error().Err(err).Str("path", cfg.AOFPath).Msg("failed to restore append-only log, starting without it")
+	}
+	// Add the local node before joining, so that the rebalancing on join hands off restored entries to their owners.
+	cs.hashRing.Add(&hashring.Node{ID: cfg.Addr, Addr: cfg.Addr, Weight: cfg.NodeWeight})
 	cs.memberlist = newMemberlist(cs, cfg)
-	cs.hashRing.Add(&hashring.Node{ID: cfg.Addr, Addr: cfg.Addr})
+	cs.cache.StartSweeper(cfg.SweepInterval)
+	cs.startAntiEntropy()
+	cs.startSnapshots()
 
 	return cs
 }
 
+// Close stops the background processes of the cacheServer, writes a final snapshot of the local cache
+// and closes the append-only log.
+// It is called during graceful shutdown, after the gRPC server stopped serving requests.
+func (cs *cacheServer) Close() {
+	cs.stopAntiEntropy()
+	cs.stopSnapshots()
+	cs.cache.StopSweeper()
+
+	if err := cs.saveSnapshot(); err != nil {
+		log.Error().Err(err).Str("path", cs.snapshots.path).Msg("failed to write snapshot on shutdown")
+	}
+	cs.closeLog()
+
+	stats := cs.cache.Stats()
+	log.Info().Uint64("sweep_runs", stats.SweepRuns).Uint64("swept_items", stats.SweptItems).Msg("stopped cache sweeper")
+	log.Info().Uint64("rounds", cs.antiEntropy.rounds.Load()).Uint64("synced_entries", cs.antiEntropy.synced.Load()).Msg("stopped anti-entropy")
+	log.Info().Uint64("read_repairs", cs.readRepairs.Load()).Msg("stopped cache server")
+}
+
+// Dispatches a change to the local cache to the append-only log and the watchers.
+// It is registered as the listener of the cache, see `cache.Listener`.
+func (cs *cacheServer) onChange(event cache.Event) {
+	cs.appendLog(event)
+	cs.watchers.publish(event)
+}
+
 // Set stores a key-value pair in the distributed cache, ensuring write quorum among nodes.
 // It either stores the value locally or forwards the request to other nodes if necessary.
+// The number of replicas that must acknowledge the write depends on the consistency level of the request.
+// The coordinating node assigns the version of the write from its hybrid logical clock, so that
+// all replicas resolve concurrent writes to the same key deterministically by last-writer-wins.
 func (cs *cacheServer) Set(ctx context.Context, req *pb.SetRequest) (*empty.Empty, error) {
 	isForwarded := req.SourceNode != ""
 	if isForwarded {
-		cs.cache.Set(req)
+		cs.clock.Update(hlc.Timestamp(req.Version))
+		mark := cs.logMark()
+		if err := cs.cache.Set(req); err != nil {
+			return nil, status.Errorf(codes.ResourceExhausted, "failed to set key %q: %v", req.Key, err)
+		}
+		if err := cs.awaitLog(mark); err != nil {
+			return nil, err
+		}
 		return &empty.Empty{}, nil
 	}
+	if req.Ttl < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "ttl must not be negative")
+	}
+	if !cs.cache.Fits(req) {
+		return nil, status.Errorf(codes.ResourceExhausted, "failed to set key %q: %v", req.Key, cache.ErrItemTooLarge)
+	}
 	req.SourceNode = cs.config.Addr
+	req.Version = uint64(cs.clock.Now())
+
+	// Resolve the absolute expiry time once, so that all replicas agree on it.
+	if expiryTime := cs.cache.ExpiryTime(req); !expiryTime.IsZero() {
+		req.ExpiryTime = expiryTime.UnixNano()
+	}
 
 	nodes, ok := cs.hashRing.GetNodes(req.Key)
 	if !ok {
 		return nil, status.Errorf(codes.Internal, "not enough nodes available to achieve write quorum")
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(nodes))
-	var writeSuccess int32
-
-	for _, node := range nodes {
-		if node.Addr == cs.config.Addr {
-			go func() {
-				defer wg.Done()
-				atomic.AddInt32(&writeSuccess, 1)
-			}()
-		} else {
-			go func(target string) {
-				defer wg.Done()
-				if err := cs.forwardSet(req, node.Addr); err == nil {
-					atomic.AddInt32(&writeSuccess, 1)
-				}
-			}(node.Addr)
+	achieved, err := cs.replicateWrite(ctx, nodes, requiredReplicas(req.Consistency, len(nodes), cs.config.WriteQuorum), func(ctx context.Context, target string) error {
+		err := cs.forwardSet(ctx, req, target)
+		if err != nil {
+			cs.hintSet(req, target)
 		}
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
-
-	wg.Wait()
-	if atomic.LoadInt32(&writeSuccess) < int32(cs.hashRing.Replication) {
+	if !achieved {
 		log.Error().Str("addr", cs.config.Addr).Msg("no write quorum achieved")
+		cs.metrics.quorumFailed("write")
 		return nil, status.Errorf(codes.Internal, "no write quorum achived")
 	}
 
-	cs.cache.Set(req)
+	// The coordinator only keeps the entry if it is one of the replicas of the key.
+	if !containsNode(nodes, cs.config.Addr) {
+		return &empty.Empty{}, nil
+	}
+	mark := cs.logMark()
+	if err := cs.cache.Set(req); err != nil {
+		return nil, status.Errorf(codes.ResourceExhausted, "failed to set key %q: %v", req.Key, err)
+	}
+	if err := cs.awaitLog(mark); err != nil {
+		return nil, err
+	}
 	return &empty.Empty{}, nil
 }
 
 // Get retrieves a key-value pair from the distributed cache, ensuring read quorum among nodes.
 // It either retrieves the value locally or forwards the request to other nodes if necessary.
+// The number of replicas that must answer, with or without an entry, depends on the consistency level of the request.
 func (cs *cacheServer) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
 	isForwarded := req.SourceNode != ""
 	if isForwarded {
-		resp, ok := cs.cache.Get(req)
+		entry, ok := cs.cache.Lookup(req.Key)
 		if !ok {
 			return nil, status.Errorf(codes.NotFound, "no entry for key %q found", req.Key)
 		}
-		return resp, nil
+		return toGetResponse(entry), nil
 	}
-	req.SourceNode = cs.config.Addr
 
-	nodes, ok := cs.hashRing.GetNodes(req.Key)
-	if !ok {
+	replies, required, err := cs.readReplicas(ctx, req.Key, req.Consistency, answered)
+	if err != nil {
+		if code := status.Code(err); code == codes.DeadlineExceeded || code == codes.Canceled {
+			return nil, err
+		}
 		return nil, status.Errorf(codes.NotFound, "no entry for key %q found", req.Key)
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(nodes))
-	var readSuccess int32
-	responseCh := make(chan *pb.GetResponse, len(nodes))
+	return cs.resolveRead(ctx, req.Key, replies, required)
+}
 
-	for _, node := range nodes {
-		if node.Addr == cs.config.Addr {
-			go func() {
-				defer wg.Done()
-				item, ok := cs.cache.Get(req)
-				if ok {
-					atomic.AddInt32(&readSuccess, 1)
-					responseCh <- item
-				}
-			}()
-		} else {
-			go func(target string) {
-				defer wg.Done()
-				item, err := cs.forwardGet(req, target)
-				if err == nil {
-					atomic.AddInt32(&readSuccess, 1)
-					responseCh <- item
+// Reads the key from its replicas until the replicas required by the consistency level, see `requiredReplicas`,
+// answered with a reply accepted by `counts` and all
+// replies agree on the entry, or until so many replicas failed or answered otherwise that the quorum cannot be
+// achieved anymore. If the replies disagree, the remaining replicas are read as well, so that the newest entry
+// is found and all stale replicas are repaired. It returns the replies received so far, either with an entry or
+// without one; replicas that could not be reached are not part of the replies. Reads still in flight are
+// cancelled. The caller has to check the quorum against the returned number of required replicas. The hybrid
+// logical clock is advanced past the version of every reply, so that later writes of this node supersede them.
+//
+// The local replica is read first. If hedging is enabled, only as many replicas as required are read at first;
+// another replica is read whenever one fails, and whenever the read takes longer than the hedging threshold.
+func (cs *cacheServer) readReplicas(ctx context.Context, key string, level pb.ConsistencyLevel, counts func(reply replicaReply) bool) ([]replicaReply, int, error) {
+	nodes, ok := cs.hashRing.GetNodes(key)
+	if !ok {
+		return nil, 0, status.Errorf(codes.Internal, "not enough nodes available to achieve read quorum")
+	}
+	required := requiredReplicas(level, len(nodes), cs.config.ReadQuorum)
+	req := &pb.GetRequest{Key: key, SourceNode: cs.config.Addr}
+
+	nodes = slices.Clone(nodes)
+	if i := slices.IndexFunc(nodes, func(node *hashring.Node) bool { return node.Addr == cs.config.Addr }); i > 0 {
+		nodes[0], nodes[i] = nodes[i], nodes[0]
+	}
+
+	fwdCtx, _, cancel := forwardContext(ctx)
+	defer cancel()
+
+	// Each replica sends exactly one reply, nil if it could not be reached.
+	replyCh := make(chan *replicaReply, len(nodes))
+	next, inflight := 0, 0
+	read := func() {
+		target := nodes[next].Addr
+		next++
+		inflight++
+
+		if target == cs.config.Addr {
+			entry, ok := cs.cache.Lookup(req.Key)
+			if !ok {
+				replyCh <- &replicaReply{addr: target}
+				return
+			}
+			replyCh <- &replicaReply{addr: target, resp: toGetResponse(entry)}
+			return
+		}
+
+		go func() {
+			item, err := cs.forwardGet(fwdCtx, req, target)
+			if err != nil {
+				if status.Code(err) == codes.NotFound {
+					replyCh <- &replicaReply{addr: target}
+					return
 				}
-			}(node.Addr)
+				replyCh <- nil
+				return
+			}
+			replyCh <- &replicaReply{addr: target, resp: item}
+		}()
+	}
+
+	initial := len(nodes)
+	var hedge <-chan time.Time
+	if delay, ok := cs.readLatency.hedgeDelay(); ok && required < len(nodes) {
+		initial = max(required, 1)
+		ticker := time.NewTicker(delay)
+		defer ticker.Stop()
+		hedge = ticker.C
+	}
+	for next < initial {
+		read()
+	}
+
+	replies := make([]replicaReply, 0, len(nodes))
+	counted := 0
+	for {
+		if counted >= required && (agree(replies) || next == len(nodes) && inflight == 0) {
+			break
+		}
+		if counted+inflight+len(nodes)-next < required {
+			break
+		}
+
+		switch {
+		case counted >= required:
+			// The replies disagree, read the remaining replicas to find the newest entry.
+			for next < len(nodes) {
+				read()
+			}
+		case counted+inflight < required:
+			// A replica failed or answered otherwise, replace it right away.
+			read()
+			continue
+		}
+
+		select {
+		case reply := <-replyCh:
+			inflight--
+			if reply == nil {
+				continue
+			}
+			if reply.resp != nil {
+				cs.clock.Update(hlc.Timestamp(reply.resp.Version))
+			}
+			replies = append(replies, *reply)
+			if counts(*reply) {
+				counted++
+			}
+		case <-hedge:
+			if next < len(nodes) {
+				read()
+				cs.metrics.hedgedReads.Inc()
+			}
+		case <-ctx.Done():
+			return nil, required, status.FromContextError(ctx.Err()).Err()
+		}
+	}
+
+	// Reads in flight fail as well once the deadline of the caller expired, which may decide the quorum first.
+	if counted < required {
+		if err := callerErr(ctx); err != nil {
+			return nil, required, err
 		}
 	}
 
-	wg.Wait()
-	close(responseCh)
+	return replies, required, nil
+}
+
+// Reports whether the replica answered, with or without an entry.
+func answered(replicaReply) bool {
+	return true
+}
 
-	if int(atomic.LoadInt32(&readSuccess)) < cs.hashRing.Replication {
+// Resolves the replies of a quorum read for the key into the newest entry, repairing stale replicas.
+// It returns an error if fewer than `required` replicas answered, or NotFound if none of them holds the key
+// or the newest entry is a tombstone. A replica answering without an entry counts towards the quorum, since
+// the newest of `required` replies reflects the latest acknowledged write as long as `R + W > N`.
+func (cs *cacheServer) resolveRead(ctx context.Context, key string, replies []replicaReply, required int) (*pb.GetResponse, error) {
+	if len(replies) < required {
+		cs.metrics.quorumFailed("read")
 		return nil, status.Errorf(codes.Internal, "not enough nodes available to achieve read quorum")
 	}
 
-	var response *pb.GetResponse
-	var maxVersion uint32 = 0
+	response := newestReply(replies)
+	if response != nil {
+		cs.readRepair(ctx, key, response, replies)
+	}
+
+	if response == nil || response.Tombstone {
+		cs.metrics.readMisses.Inc()
+		return nil, status.Errorf(codes.NotFound, "no entry for key %q found", key)
+	}
+
+	return response, nil
+}
 
-	for resp := range responseCh {
-		if resp.Version >= maxVersion {
-			maxVersion = resp.Version
-			response = resp
+// Delete removes a key from the distributed cache, ensuring write quorum among nodes.
+// Each replica records a versioned tombstone, so that a lagging replica cannot resurrect the value during a later read.
+func (cs *cacheServer) Delete(ctx context.Context, req *pb.DeleteRequest) (*empty.Empty, error) {
+	isForwarded := req.SourceNode != ""
+	if isForwarded {
+		cs.clock.Update(hlc.Timestamp(req.Version))
+		mark := cs.logMark()
+		cs.cache.Delete(req)
+		if err := cs.awaitLog(mark); err != nil {
+			return nil, err
 		}
+		return &empty.Empty{}, nil
 	}
+	req.SourceNode = cs.config.Addr
+	req.Version = uint64(cs.clock.Now())
 
-	if response == nil {
-		return nil, status.Errorf(codes.NotFound, "no entry for key %q found", req.Key)
+	nodes, ok := cs.hashRing.GetNodes(req.Key)
+	if !ok {
+		return nil, status.Errorf(codes.Internal, "not enough nodes available to achieve write quorum")
 	}
 
-	return response, nil
+	achieved, err := cs.replicateWrite(ctx, nodes, requiredReplicas(req.Consistency, len(nodes), cs.config.WriteQuorum), func(ctx context.Context, target string) error {
+		err := cs.forwardDelete(ctx, req, target)
+		if err != nil {
+			cs.hintDelete(req, target)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !achieved {
+		log.Error().Str("addr", cs.config.Addr).Msg("no write quorum achieved")
+		cs.metrics.quorumFailed("write")
+		return nil, status.Errorf(codes.Internal, "no write quorum achived")
+	}
+
+	if containsNode(nodes, cs.config.Addr) {
+		mark := cs.logMark()
+		cs.cache.Delete(req)
+		if err := cs.awaitLog(mark); err != nil {
+			return nil, err
+		}
+	}
+	return &empty.Empty{}, nil
+}
+
+// Transfer receives a stream of entries handed off by another node, e.g. after the membership of the hash ring changed.
+// Each entry is merged into the local cache with its version and expiry time, unless the local entry is newer.
+func (cs *cacheServer) Transfer(stream pb.CacheService_TransferServer) error {
+	received, merged := 0, 0
+	mark := cs.logMark()
+	for {
+		entry, err := stream.Recv()
+		if err == io.EOF {
+			log.Info().Str("addr", cs.config.Addr).Int("received", received).Int("merged", merged).Msg("received transfer")
+			// The sender may drop its copies once the transfer completed.
+			if err := cs.awaitLog(mark); err != nil {
+				return err
+			}
+			return stream.SendAndClose(&empty.Empty{})
+		}
+		if err != nil {
+			return err
+		}
+
+		received++
+		cs.clock.Update(hlc.Timestamp(entry.Version))
+		if cs.cache.Merge(entry) {
+			merged++
+		}
+	}
 }
 
 // Forwards a Set request to the target node over gRPC.
 // If the request is successful, it returns nil, otherwise, it returns an error.
-func (cs *cacheServer) forwardSet(in *pb.SetRequest, target string) error {
+func (cs *cacheServer) forwardSet(ctx context.Context, in *pb.SetRequest, target string) (err error) {
 	log.Info().Str("addr", target).Msg("forwarding set request to target node")
+	defer func(start time.Time) { cs.metrics.observeForward("set", target, start, err) }(time.Now())
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
 	defer cancel()
 
 	client, err := cs.connPool.get(target)
@@ -182,12 +467,41 @@ func (cs *cacheServer) forwardSet(in *pb.SetRequest, target string) error {
 	return nil
 }
 
+// Forwards a Delete request to the target node over gRPC.
+// If the request is successful, it returns nil, otherwise, it returns an error.
+func (cs *cacheServer) forwardDelete(ctx context.Context, in *pb.DeleteRequest, target string) (err error) {
+	log.Info().Str("addr", target).Msg("forwarding delete request to target node")
+	defer func(start time.Time) { cs.metrics.observeForward("delete", target, start, err) }(time.Now())
+
+	ctx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
+	defer cancel()
+
+	client, err := cs.connPool.get(target)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create grpc client while forwarding request")
+		return err
+	}
+
+	if _, err := client.Delete(ctx, in); err != nil {
+		log.Error().Err(err).Str("addr", target).Msg("failed to forward delete request")
+		return err
+	}
+
+	return nil
+}
+
 // Forwards a Get request to the target node over gRPC.
 // If the request is successful, it returns the response, otherwise, it returns an error.
-func (cs *cacheServer) forwardGet(in *pb.GetRequest, target string) (*pb.GetResponse, error) {
+func (cs *cacheServer) forwardGet(ctx context.Context, in *pb.GetRequest, target string) (resp *pb.GetResponse, err error) {
 	log.Info().Str("addr", target).Msg("forwarding get request on target node")
+	defer func(start time.Time) {
+		cs.metrics.observeForward("get", target, start, err)
+		if err == nil || status.Code(err) == codes.NotFound {
+			cs.readLatency.observe(time.Since(start))
+		}
+	}(time.Now())
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	ctx, cancel := context.WithTimeout(ctx, cs.config.RPCTimeout)
 	defer cancel()
 
 	client, err := cs.connPool.get(target)
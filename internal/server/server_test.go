@@ -2,19 +2,42 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"io"
 	"log"
 	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/marvinlanhenke/go-distributed-cache/internal/aof"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/cache"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/config"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/snapshot"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 func createHashRing(addrs []string, replication int) *hashring.HashRing {
@@ -28,31 +51,65 @@ func createHashRing(addrs []string, replication int) *hashring.HashRing {
 	return hashRing
 }
 
+// Wraps a listener to signal once the gRPC server started accepting connections on it.
+type servingListener struct {
+	net.Listener               // Listener the gRPC server accepts connections on.
+	once         sync.Once     // Ensures the channel is closed only once.
+	accepting    chan struct{} // Closed on the first call to Accept.
+}
+
+// Signals that the server is accepting connections and accepts the next one.
+func (l *servingListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { close(l.accepting) })
+	return l.Listener.Accept()
+}
+
 func startServer(port string, hashRing *hashring.HashRing) (*cacheServer, *grpc.Server) {
 	config, _ := config.New()
 	config.Addr = port
 
 	srv := &cacheServer{
-		cache:    cache.New(10, 100, time.Second*3600),
 		hashRing: hashRing,
-		connPool: newGrpcConnPool(),
-		config:   config,
-		limiter:  rate.NewLimiter(rate.Limit(10), 100),
+		connPool: newGrpcConnPool(
+			grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+			grpc.WithChainUnaryInterceptor(sourceNodeUnaryInterceptor(port, config.ClusterSecret)),
+			grpc.WithChainStreamInterceptor(sourceNodeStreamInterceptor(port, config.ClusterSecret)),
+		),
+		config:      config,
+		clock:       hlc.New(),
+		limiter:     newRateLimiter(10, 100),
+		hints:       newHintStore(100, time.Minute),
+		antiEntropy: newAntiEntropy(0, 4, 0),
+		watchers:    newWatchHub(),
+		snapshots:   newSnapshotter("", 0),
+		readLatency: newLatencyTracker(0),
+		increments:  newIncrementStore(100, time.Minute),
 	}
+	srv.cache = cache.New(10, 100, time.Second*3600, cache.WithListener(srv.onChange))
+	srv.metrics = newMetrics(srv)
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(srv.RateLimitUnaryInterceptor()),
+		grpc.ChainStreamInterceptor(srv.RateLimitStreamInterceptor()),
+	)
 	pb.RegisterCacheServiceServer(grpcServer, srv)
 	reflection.Register(grpcServer)
 
-	go func(port string, srv *grpc.Server) {
-		lis, err := net.Listen("tcp", port)
-		if err != nil {
-			log.Fatalf("failed to listen: %v", err)
-		}
-		if err := grpcServer.Serve(lis); err != nil {
+	lis, err := net.Listen("tcp", port)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	serving := &servingListener{Listener: lis, accepting: make(chan struct{})}
+
+	go func(lis net.Listener, srv *grpc.Server) {
+		if err := srv.Serve(lis); err != nil {
 			log.Fatalf("failed to serve grpc server: %v", err)
 		}
-	}(port, grpcServer)
+	}(serving, grpcServer)
+
+	// Wait until the server accepts connections, so that stopping it releases the port for the next test.
+	<-serving.accepting
 
 	return srv, grpcServer
 }
@@ -70,11 +127,42 @@ func TestServerSetSuccess(t *testing.T) {
 	ctx := context.Background()
 	req := &pb.SetRequest{
 		Key:   "test-key",
-		Value: "test-value",
+		Value: []byte("test-value"),
+	}
+
+	_, err := srv1.Set(ctx, req)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+}
+
+func TestServerSetAssignsExpiryTime(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	_, grpc3 := startServer(":8082", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	defer grpc3.Stop()
+
+	ctx := context.Background()
+	req := &pb.SetRequest{
+		Key:   "test-key",
+		Value: []byte("test-value"),
+		Ttl:   60,
 	}
 
 	_, err := srv1.Set(ctx, req)
 	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.NotZero(t, req.ExpiryTime, "expected expiry time to be assigned by the coordinator")
+
+	req = &pb.SetRequest{
+		Key:   "test-key",
+		Value: []byte("test-value"),
+		Ttl:   -1,
+	}
+
+	_, err = srv1.Set(ctx, req)
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "expected %v, instead got %v", codes.InvalidArgument, status.Code(err))
 }
 
 func TestServerSetNoWriteQuorum(t *testing.T) {
@@ -86,7 +174,7 @@ func TestServerSetNoWriteQuorum(t *testing.T) {
 	ctx := context.Background()
 	req := &pb.SetRequest{
 		Key:   "test-key",
-		Value: "test-value",
+		Value: []byte("test-value"),
 	}
 
 	_, err := srv1.Set(ctx, req)
@@ -106,16 +194,17 @@ func TestServerGetSuccess(t *testing.T) {
 	ctx := context.Background()
 	setReq := &pb.SetRequest{
 		Key:   "test-key",
-		Value: "test-value",
+		Value: []byte("test-value"),
 	}
 
 	_, err := srv1.Set(ctx, setReq)
 	require.NoError(t, err, "expected no error, instead got %v", err)
 
 	getReq := &pb.GetRequest{Key: "test-key"}
-	expected := &pb.GetResponse{Value: "test-value", Version: uint32(0)}
+	expected := &pb.GetResponse{Value: []byte("test-value"), Version: setReq.Version}
 	result, err := srv1.Get(ctx, getReq)
 	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.NotZero(t, result.Version, "expected the coordinator to assign a version")
 	require.Equal(t, expected.Value, result.Value, "expected %v, instead got %v", expected.Value, result.Value)
 	require.Equal(t, expected.Version, result.Version, "expected %v, instead got %v", expected.Version, result.Version)
 }
@@ -131,7 +220,7 @@ func TestServerGetNoReadQuorum(t *testing.T) {
 	ctx := context.Background()
 	setReq := &pb.SetRequest{
 		Key:   "test-key",
-		Value: "test-value",
+		Value: []byte("test-value"),
 	}
 
 	_, err := srv1.Set(ctx, setReq)
@@ -144,3 +233,1235 @@ func TestServerGetNoReadQuorum(t *testing.T) {
 	_, err = srv1.Get(ctx, getReq)
 	require.Error(t, err, "expected error, instead got %v", err)
 }
+
+func TestServerDeleteSuccess(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	_, grpc3 := startServer(":8082", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	defer grpc3.Stop()
+
+	ctx := context.Background()
+	setReq := &pb.SetRequest{
+		Key:   "test-key",
+		Value: []byte("test-value"),
+	}
+
+	_, err := srv1.Set(ctx, setReq)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	_, err = srv1.Delete(ctx, &pb.DeleteRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	_, err = srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.Equal(t, codes.NotFound, status.Code(err), "expected %v, instead got %v", codes.NotFound, status.Code(err))
+}
+
+func TestServerDeleteTombstoneWinsOverStaleReplica(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	srv3, grpc3 := startServer(":8082", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	defer grpc3.Stop()
+	servers := map[string]*cacheServer{":8080": srv1, ":8081": srv2, ":8082": srv3}
+
+	ctx := context.Background()
+	setReq := &pb.SetRequest{
+		Key:   "test-key",
+		Value: []byte("test-value"),
+	}
+
+	_, err := srv1.Set(ctx, setReq)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	nodes, ok := hashRing.GetNodes("test-key")
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+
+	// Only one replica receives the delete, the other one keeps the stale value.
+	replica := servers[nodes[0].Addr]
+	replica.cache.Delete(&pb.DeleteRequest{Key: "test-key"})
+
+	_, err = srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.Equal(t, codes.NotFound, status.Code(err), "expected %v, instead got %v", codes.NotFound, status.Code(err))
+}
+
+func TestServerRebalanceOnJoin(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	srv3, grpc3 := startServer(":8082", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	defer grpc3.Stop()
+
+	ctx := context.Background()
+	keys := make([]string, 50)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("test-key-%d", i)
+		_, err := srv1.Set(ctx, &pb.SetRequest{Key: keys[i], Value: []byte("test-value")})
+		require.NoError(t, err, "expected no error, instead got %v", err)
+	}
+
+	prev := hashRing.Clone()
+	hashRing.Add(&hashring.Node{ID: ":8082", Addr: ":8082"})
+	srv1.rebalance(prev)
+	srv2.rebalance(prev)
+
+	gained := 0
+	for _, key := range keys {
+		nodes, ok := hashRing.GetNodes(key)
+		require.True(t, ok, "expected %v, instead got %v", true, ok)
+
+		_, ok = srv3.cache.Get(&pb.GetRequest{Key: key})
+		require.Equal(t, containsNode(nodes, ":8082"), ok, "unexpected ownership of key %q on the joined node", key)
+		if ok {
+			gained++
+		}
+
+		_, ok = srv1.cache.Get(&pb.GetRequest{Key: key})
+		require.Equal(t, containsNode(nodes, ":8080"), ok, "unexpected ownership of key %q on the existing node", key)
+
+		result, err := srv1.Get(ctx, &pb.GetRequest{Key: key})
+		require.NoError(t, err, "expected no error, instead got %v", err)
+		require.Equal(t, "test-value", string(result.Value), "expected %v, instead got %v", "test-value", string(result.Value))
+	}
+	require.NotZero(t, gained, "expected the joined node to take over keys")
+}
+
+func TestServerHintedHandoff(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	defer grpc1.Stop()
+
+	ctx := context.Background()
+	setReq := &pb.SetRequest{
+		Key:   "test-key",
+		Value: []byte("test-value"),
+	}
+
+	_, err := srv1.Set(ctx, setReq)
+	require.Error(t, err, "expected an error, instead got %v", err)
+	require.Equal(t, 1, srv1.hints.len(":8081"), "expected %d hint, instead got %d", 1, srv1.hints.len(":8081"))
+
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc2.Stop()
+
+	require.Eventually(t, func() bool {
+		srv1.replayHints(":8081")
+		return srv1.hints.len(":8081") == 0
+	}, 10*time.Second, 100*time.Millisecond, "expected all hints to be replayed")
+
+	result, ok := srv2.cache.Get(&pb.GetRequest{Key: "test-key"})
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+	require.Equal(t, "test-value", string(result.Value), "expected %v, instead got %v", "test-value", string(result.Value))
+}
+
+func TestHintStoreBounds(t *testing.T) {
+	store := newHintStore(2, time.Minute)
+
+	ok := store.add(":8081", "key1", &hint{set: &pb.SetRequest{Key: "key1"}, createdAt: time.Now()})
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+
+	ok = store.add(":8081", "key1", &hint{delete: &pb.DeleteRequest{Key: "key1"}, createdAt: time.Now()})
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+	require.Equal(t, 1, store.len(":8081"), "expected %d hint, instead got %d", 1, store.len(":8081"))
+
+	ok = store.add(":8082", "key2", &hint{set: &pb.SetRequest{Key: "key2"}, createdAt: time.Now().Add(-2 * time.Minute)})
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+
+	// The store is full, but the expired hint is pruned to make room.
+	ok = store.add(":8082", "key3", &hint{set: &pb.SetRequest{Key: "key3"}, createdAt: time.Now()})
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+
+	ok = store.add(":8082", "key4", &hint{set: &pb.SetRequest{Key: "key4"}, createdAt: time.Now()})
+	require.False(t, ok, "expected %v, instead got %v", false, ok)
+
+	hints := store.take(":8081")
+	require.Len(t, hints, 1, "expected len of %d, instead got %d", 1, len(hints))
+	require.NotNil(t, hints["key1"].delete, "expected the latest hint to be kept")
+}
+
+func TestServerReadRepair(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	srv1.config.ReadRepair = config.ReadRepairSync
+
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("test-value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// Only one replica receives the update, leaving the other one stale.
+	srv2.cache.Set(&pb.SetRequest{Key: "test-key", Value: []byte("new-value")})
+
+	result, err := srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "new-value", string(result.Value), "expected %v, instead got %v", "new-value", string(result.Value))
+	require.Equal(t, uint64(1), srv1.readRepairs.Load(), "expected %d repair, instead got %d", 1, srv1.readRepairs.Load())
+
+	repaired, ok := srv1.cache.Get(&pb.GetRequest{Key: "test-key"})
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+	require.Equal(t, result.Value, repaired.Value, "expected %v, instead got %v", result.Value, repaired.Value)
+	require.Equal(t, result.Version, repaired.Version, "expected %v, instead got %v", result.Version, repaired.Version)
+}
+
+func TestServerAntiEntropy(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: "shared-key", Value: []byte("shared-value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// Writes that reached only one of the replicas, e.g. because a forward failed.
+	srv1.cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1")})
+	srv2.cache.Set(&pb.SetRequest{Key: "key2", Value: []byte("value2")})
+	srv2.cache.Set(&pb.SetRequest{Key: "shared-key", Value: []byte("new-value")})
+
+	err = srv1.syncReplica(ctx, ":8081")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	for _, srv := range []*cacheServer{srv1, srv2} {
+		for key, value := range map[string]string{"key1": "value1", "key2": "value2", "shared-key": "new-value"} {
+			result, ok := srv.cache.Get(&pb.GetRequest{Key: key})
+			require.True(t, ok, "expected %v, instead got %v", true, ok)
+			require.Equal(t, value, string(result.Value), "expected %v, instead got %v", value, string(result.Value))
+		}
+	}
+
+	tree1, _ := srv1.sharedEntries(":8081", 4)
+	tree2, _ := srv2.sharedEntries(":8080", 4)
+	require.Equal(t, tree1.Root(), tree2.Root(), "expected %v, instead got %v", tree1.Root(), tree2.Root())
+}
+
+func TestServerAntiEntropyRateLimited(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	// More entries than fit into a single batch are sent in several rate-limited transfers.
+	srv1.antiEntropy = newAntiEntropy(0, 4, 10)
+	for i := 0; i < 25; i++ {
+		srv1.cache.Set(&pb.SetRequest{Key: fmt.Sprintf("key%d", i), Value: []byte("value")})
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	err := srv1.syncReplica(ctx, ":8081")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.GreaterOrEqual(t, time.Since(start), time.Second, "expected at least %v, instead got %v", time.Second, time.Since(start))
+
+	for i := 0; i < 25; i++ {
+		_, ok := srv2.cache.Get(&pb.GetRequest{Key: fmt.Sprintf("key%d", i)})
+		require.True(t, ok, "expected %v, instead got %v", true, ok)
+	}
+	require.Equal(t, uint64(25), srv1.antiEntropy.synced.Load(), "expected %v, instead got %v", 25, srv1.antiEntropy.synced.Load())
+}
+
+func TestServerCompareAndSet(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	ctx := context.Background()
+	_, err := srv1.CompareAndSet(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("value1")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	result, err := srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	_, err = srv1.CompareAndSet(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("value2"), ExpectedVersion: result.Version - 1})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "expected %v, instead got %v", codes.FailedPrecondition, status.Code(err))
+
+	_, err = srv1.CompareAndSet(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("value2"), ExpectedVersion: result.Version})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	result, err = srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "value2", string(result.Value), "expected %v, instead got %v", "value2", string(result.Value))
+}
+
+func TestServerReadAdvancesClock(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	srv1.config.ReadRepair = config.ReadRepairSync
+
+	// An entry written by a coordinator whose clock runs ahead, which only reached one of the replicas.
+	version := uint64(hlc.Timestamp(time.Now().Add(50*time.Millisecond).UnixMilli()) << 16)
+	srv2.cache.Merge(&pb.Entry{Key: "test-key", Value: []byte("value"), Version: version})
+
+	ctx := context.Background()
+	_, err := srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	now := uint64(srv1.clock.Now())
+	require.Greater(t, now, version, "expected timestamp greater than %v, instead got %v", version, now)
+
+	// A later write coordinated by the node supersedes the entry it read.
+	_, err = srv1.Set(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("new-value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	result, err := srv2.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "new-value", string(result.Value), "expected %v, instead got %v", "new-value", string(result.Value))
+}
+
+func TestServerCompareAndSetSkewedVersion(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	// An entry written by a coordinator whose clock runs ahead of the local one.
+	version := uint64(hlc.Timestamp(time.Now().Add(50*time.Millisecond).UnixMilli()) << 16)
+	for _, srv := range []*cacheServer{srv1, srv2} {
+		srv.cache.Merge(&pb.Entry{Key: "test-key", Value: []byte("old"), Version: version})
+	}
+
+	ctx := context.Background()
+	_, err := srv1.CompareAndSet(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("new"), ExpectedVersion: version})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	result, err := srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "new", string(result.Value), "expected %v, instead got %v", "new", string(result.Value))
+	require.Greater(t, result.Version, version, "expected version greater than %v, instead got %v", version, result.Version)
+}
+
+func TestServerSetIfAbsentAcrossCoordinators(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	// Conditional writes received by either node are serialized on the primary replica, so only one of them wins.
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	var succeeded atomic.Int32
+	for i := 0; i < 20; i++ {
+		srv := srv1
+		if i%2 == 1 {
+			srv = srv2
+		}
+		wg.Add(1)
+		go func(srv *cacheServer, value string) {
+			defer wg.Done()
+			_, err := srv.SetIfAbsent(ctx, &pb.SetRequest{Key: "test-key", Value: []byte(value)})
+			if err == nil {
+				succeeded.Add(1)
+				return
+			}
+			require.Equal(t, codes.FailedPrecondition, status.Code(err), "expected %v, instead got %v", codes.FailedPrecondition, status.Code(err))
+		}(srv, fmt.Sprintf("value%d", i))
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(1), succeeded.Load(), "expected %v, instead got %v", 1, succeeded.Load())
+}
+
+func TestServerSetIfAbsentAndPresent(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	ctx := context.Background()
+	_, err := srv1.SetIfPresent(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("value1")})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "expected %v, instead got %v", codes.FailedPrecondition, status.Code(err))
+
+	_, err = srv1.SetIfAbsent(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("value1")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	_, err = srv1.SetIfAbsent(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("value2")})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "expected %v, instead got %v", codes.FailedPrecondition, status.Code(err))
+
+	_, err = srv1.SetIfPresent(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("value2")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// A deleted key counts as absent.
+	_, err = srv1.Delete(ctx, &pb.DeleteRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	_, err = srv1.SetIfAbsent(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("value3")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	result, err := srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "value3", string(result.Value), "expected %v, instead got %v", "value3", string(result.Value))
+}
+
+func TestServerConsistencyLevels(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	defer grpc1.Stop()
+
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("test-value")})
+	require.Error(t, err, "expected an error, instead got %v", err)
+
+	_, err = srv1.Set(ctx, &pb.SetRequest{Key: "test-key", Value: []byte("test-value"), Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_ONE})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	result, err := srv1.Get(ctx, &pb.GetRequest{Key: "test-key", Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_ONE})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "test-value", string(result.Value), "expected %v, instead got %v", "test-value", string(result.Value))
+
+	_, err = srv1.Get(ctx, &pb.GetRequest{Key: "test-key", Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM})
+	require.Error(t, err, "expected an error, instead got %v", err)
+
+	srv1.config.ReadQuorum = 1
+	_, err = srv1.Get(ctx, &pb.GetRequest{Key: "test-key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+}
+
+func TestRequiredReplicas(t *testing.T) {
+	tests := []struct {
+		level    pb.ConsistencyLevel
+		quorum   int
+		expected int
+	}{
+		{pb.ConsistencyLevel_CONSISTENCY_LEVEL_DEFAULT, 0, 5},
+		{pb.ConsistencyLevel_CONSISTENCY_LEVEL_DEFAULT, 2, 2},
+		{pb.ConsistencyLevel_CONSISTENCY_LEVEL_DEFAULT, 7, 5},
+		{pb.ConsistencyLevel_CONSISTENCY_LEVEL_ONE, 2, 1},
+		{pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM, 2, 3},
+		{pb.ConsistencyLevel_CONSISTENCY_LEVEL_ALL, 2, 5},
+	}
+
+	for _, tt := range tests {
+		result := requiredReplicas(tt.level, 5, tt.quorum)
+		require.Equal(t, tt.expected, result, "expected %d, instead got %d", tt.expected, result)
+	}
+}
+
+func TestServerMultiSetAndMultiGet(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	_, grpc3 := startServer(":8082", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	defer grpc3.Stop()
+
+	ctx := context.Background()
+	setReq := &pb.MultiSetRequest{}
+	for i := 0; i < 20; i++ {
+		setReq.Entries = append(setReq.Entries, &pb.SetRequest{Key: fmt.Sprintf("key%d", i), Value: []byte(fmt.Sprintf("value%d", i))})
+	}
+	setReq.Entries = append(setReq.Entries, &pb.SetRequest{Key: "invalid", Value: []byte("value"), Ttl: -1})
+
+	setResp, err := srv1.MultiSet(ctx, setReq)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Len(t, setResp.Results, 21, "expected len of %d, instead got %d", 21, len(setResp.Results))
+	for _, result := range setResp.Results[:20] {
+		require.Equal(t, uint32(codes.OK), result.Code, "expected %v, instead got %v", codes.OK, result.Error)
+	}
+	require.Equal(t, uint32(codes.InvalidArgument), setResp.Results[20].Code, "expected %v, instead got %v", codes.InvalidArgument, setResp.Results[20].Code)
+
+	getResp, err := srv1.MultiGet(ctx, &pb.MultiGetRequest{Keys: []string{"key3", "missing", "key17", "key3"}})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Len(t, getResp.Results, 4, "expected len of %d, instead got %d", 4, len(getResp.Results))
+
+	for i, key := range []string{"key3", "missing", "key17", "key3"} {
+		result := getResp.Results[i]
+		require.Equal(t, key, result.Key, "expected %v, instead got %v", key, result.Key)
+		if key == "missing" {
+			require.Nil(t, result.Response, "expected no response, instead got %v", result.Response)
+			require.NotEqual(t, uint32(codes.OK), result.Code, "expected an error code, instead got %v", result.Code)
+			continue
+		}
+		expected := "value" + key[len("key"):]
+		require.Equal(t, expected, string(result.Response.Value), "expected %v, instead got %v", expected, string(result.Response.Value))
+	}
+}
+
+func TestServerBinaryValue(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	ctx := context.Background()
+	value := []byte{0x08, 0x96, 0x01, 0x00, 0xff}
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: "test-key", Value: value, ContentType: "application/x-protobuf", Flags: 1})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// The replica received the payload over gRPC without any encoding.
+	result, ok := srv2.cache.Get(&pb.GetRequest{Key: "test-key"})
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+	require.Equal(t, value, result.Value, "expected %v, instead got %v", value, result.Value)
+	require.Equal(t, "application/x-protobuf", result.ContentType, "expected %v, instead got %v", "application/x-protobuf", result.ContentType)
+	require.Equal(t, uint32(1), result.Flags, "expected %v, instead got %v", 1, result.Flags)
+}
+
+func TestServerIncrement(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := srv1.Increment(ctx, &pb.IncrementRequest{Key: "counter", Delta: 2})
+			require.NoError(t, err, "expected no error, instead got %v", err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := srv2.Decrement(ctx, &pb.IncrementRequest{Key: "counter", Delta: 1})
+			require.NoError(t, err, "expected no error, instead got %v", err)
+		}()
+	}
+	wg.Wait()
+
+	resp, err := srv2.Increment(ctx, &pb.IncrementRequest{Key: "counter"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, int64(50), resp.Value, "expected %v, instead got %v", 50, resp.Value)
+
+	for _, srv := range []*cacheServer{srv1, srv2} {
+		result, ok := srv.cache.Get(&pb.GetRequest{Key: "counter"})
+		require.True(t, ok, "expected %v, instead got %v", true, ok)
+		require.Equal(t, "50", string(result.Value), "expected %v, instead got %v", "50", string(result.Value))
+	}
+
+	_, err = srv1.Set(ctx, &pb.SetRequest{Key: "text", Value: []byte("value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = srv1.Increment(ctx, &pb.IncrementRequest{Key: "text", Delta: 1})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err), "expected %v, instead got %v", codes.FailedPrecondition, status.Code(err))
+}
+
+func TestServerIncrementRetry(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	defer grpc1.Stop()
+
+	var key string
+	for i := 0; key == ""; i++ {
+		if nodes, _ := hashRing.GetNodes(fmt.Sprintf("counter%d", i)); nodes[0].Addr == ":8080" {
+			key = fmt.Sprintf("counter%d", i)
+		}
+	}
+
+	// The increment is applied on the primary, but not replicated to the unreachable replica.
+	ctx := context.Background()
+	_, err := srv1.Increment(ctx, &pb.IncrementRequest{Key: key, Delta: 5, RequestId: "request"})
+	require.Equal(t, codes.Internal, status.Code(err), "expected %v, instead got %v", codes.Internal, status.Code(err))
+
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc2.Stop()
+
+	// Retrying with the same request ID, until the replica is reachable again, replicates the first result
+	// instead of applying the delta again.
+	var resp *pb.IncrementResponse
+	require.Eventually(t, func() bool {
+		resp, err = srv1.Increment(ctx, &pb.IncrementRequest{Key: key, Delta: 5, RequestId: "request"})
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond, "expected the retry to succeed, instead got %v", err)
+	require.Equal(t, int64(5), resp.Value, "expected %v, instead got %v", 5, resp.Value)
+
+	for _, srv := range []*cacheServer{srv1, srv2} {
+		result, ok := srv.cache.Get(&pb.GetRequest{Key: key})
+		require.True(t, ok, "expected %v, instead got %v", true, ok)
+		require.Equal(t, "5", string(result.Value), "expected %v, instead got %v", "5", string(result.Value))
+	}
+
+	// Another request ID is applied again.
+	resp, err = srv2.Increment(ctx, &pb.IncrementRequest{Key: key, Delta: 5, RequestId: "other"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, int64(10), resp.Value, "expected %v, instead got %v", 10, resp.Value)
+}
+
+func TestServerWatch(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	srv3, grpc3 := startServer(":8082", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	defer grpc3.Stop()
+
+	client, err := srv2.connPool.get(":8080")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.Watch(ctx, &pb.WatchRequest{Key: "user:", Prefix: true})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// The watch is established once every node relays its changes.
+	require.Eventually(t, func() bool {
+		for _, srv := range []*cacheServer{srv1, srv2, srv3} {
+			srv.watchers.mu.Lock()
+			n := len(srv.watchers.watchers)
+			srv.watchers.mu.Unlock()
+			if n == 0 {
+				return false
+			}
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond, "expected all nodes to be watched")
+
+	events := make(chan *pb.WatchEvent, 100)
+	go func() {
+		for {
+			event, err := stream.Recv()
+			if err != nil {
+				close(events)
+				return
+			}
+			events <- event
+		}
+	}()
+
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("user:%d", i)
+		_, err := srv2.Set(context.Background(), &pb.SetRequest{Key: key, Value: []byte("value")})
+		require.NoError(t, err, "expected no error, instead got %v", err)
+		_, err = srv3.Delete(context.Background(), &pb.DeleteRequest{Key: key})
+		require.NoError(t, err, "expected no error, instead got %v", err)
+	}
+	_, err = srv2.Set(context.Background(), &pb.SetRequest{Key: "order:1", Value: []byte("value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	received := make(map[string]int)
+	timeout := time.After(time.Second)
+	for done := false; !done; {
+		select {
+		case event := <-events:
+			received[fmt.Sprintf("%s/%s", event.Type, event.Entry.Key)]++
+		case <-timeout:
+			done = true
+		}
+	}
+
+	require.Len(t, received, 10, "expected %v events, instead got %v", 10, received)
+	for i := 0; i < 5; i++ {
+		for _, eventType := range []pb.EventType{pb.EventType_EVENT_TYPE_SET, pb.EventType_EVENT_TYPE_DELETE} {
+			id := fmt.Sprintf("%s/user:%d", eventType, i)
+			require.Equal(t, 1, received[id], "expected %v event for %v, instead got %v", 1, id, received[id])
+		}
+	}
+
+	invalid, err := client.Watch(context.Background(), &pb.WatchRequest{})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = invalid.Recv()
+	require.Equal(t, codes.InvalidArgument, status.Code(err), "expected %v, instead got %v", codes.InvalidArgument, status.Code(err))
+}
+
+func TestServerSnapshotRestore(t *testing.T) {
+	addrs := []string{":8080"}
+	hashRing := createHashRing(addrs, 1)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	defer grpc1.Stop()
+
+	path := filepath.Join(t.TempDir(), "snapshot.bin")
+	srv1.snapshots = newSnapshotter(path, 0)
+
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: "key1", Value: []byte("value1"), ContentType: "text/plain", Flags: 7})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = srv1.Set(ctx, &pb.SetRequest{Key: "key2", Value: []byte("value2")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = srv1.Delete(ctx, &pb.DeleteRequest{Key: "key2"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	err = srv1.saveSnapshot()
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	restarted := &cacheServer{
+		cache:     cache.New(10, 100, time.Second*3600),
+		clock:     hlc.New(),
+		snapshots: newSnapshotter(path, 0),
+	}
+	err = restarted.loadSnapshot()
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	for _, key := range []string{"key1", "key2"} {
+		expected, _ := srv1.cache.Lookup(key)
+		entry, ok := restarted.cache.Lookup(key)
+		require.True(t, ok, "expected %v, instead got %v", true, ok)
+		require.Equal(t, expected.Version, entry.Version, "expected %v, instead got %v", expected.Version, entry.Version)
+		require.Equal(t, expected.Tombstone, entry.Tombstone, "expected %v, instead got %v", expected.Tombstone, entry.Tombstone)
+		require.Equal(t, expected.ExpiryTime, entry.ExpiryTime, "expected %v, instead got %v", expected.ExpiryTime, entry.ExpiryTime)
+		require.Equal(t, expected.ContentType, entry.ContentType, "expected %v, instead got %v", expected.ContentType, entry.ContentType)
+		require.Equal(t, expected.Flags, entry.Flags, "expected %v, instead got %v", expected.Flags, entry.Flags)
+	}
+
+	// Writes coordinated by the restarted node supersede the restored entries.
+	deleted, _ := restarted.cache.Lookup("key2")
+	version := uint64(restarted.clock.Now())
+	require.Greater(t, version, deleted.Version, "expected version greater than %v, instead got %v", deleted.Version, version)
+}
+
+func TestServerAppendOnlyLogReplay(t *testing.T) {
+	addrs := []string{":8080"}
+	hashRing := createHashRing(addrs, 1)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	defer grpc1.Stop()
+
+	srv1.config.AOFPath = filepath.Join(t.TempDir(), "cache.aof")
+	srv1.config.AOFFsync = aof.FsyncAlways
+	err := srv1.openLog()
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	ctx := context.Background()
+	_, err = srv1.Set(ctx, &pb.SetRequest{Key: "key1", Value: []byte("value1"), ContentType: "text/plain"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = srv1.Set(ctx, &pb.SetRequest{Key: "key2", Value: []byte("value2")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = srv1.Delete(ctx, &pb.DeleteRequest{Key: "key2"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = srv1.Increment(ctx, &pb.IncrementRequest{Key: "counter", Delta: 5})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// Compacting the log keeps the latest state of every entry.
+	srv1.rewriteLog()
+	_, err = srv1.Increment(ctx, &pb.IncrementRequest{Key: "counter", Delta: 2})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	srv1.closeLog()
+
+	restarted := &cacheServer{
+		cache:     cache.New(10, 100, time.Second*3600),
+		config:    srv1.config,
+		clock:     hlc.New(),
+		snapshots: newSnapshotter("", 0),
+	}
+	err = restarted.openLog()
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	defer restarted.closeLog()
+
+	for _, key := range []string{"key1", "key2", "counter"} {
+		expected, _ := srv1.cache.Lookup(key)
+		entry, ok := restarted.cache.Lookup(key)
+		require.True(t, ok, "expected %v, instead got %v", true, ok)
+		require.Equal(t, expected.Value, entry.Value, "expected %v, instead got %v", expected.Value, entry.Value)
+		require.Equal(t, expected.Version, entry.Version, "expected %v, instead got %v", expected.Version, entry.Version)
+		require.Equal(t, expected.Tombstone, entry.Tombstone, "expected %v, instead got %v", expected.Tombstone, entry.Tombstone)
+		require.Equal(t, expected.ContentType, entry.ContentType, "expected %v, instead got %v", expected.ContentType, entry.ContentType)
+	}
+}
+
+func TestServerCorruptFilesSetAside(t *testing.T) {
+	dir := t.TempDir()
+	snapshotPath := filepath.Join(dir, "snapshot.bin")
+	aofPath := filepath.Join(dir, "cache.aof")
+	for _, path := range []string{snapshotPath, aofPath} {
+		err := os.WriteFile(path, []byte("corrupt"), 0o644)
+		require.NoError(t, err, "expected no error, instead got %v", err)
+	}
+
+	config, _ := config.New()
+	config.AOFPath = aofPath
+	config.AOFFsync = aof.FsyncAlways
+	srv := &cacheServer{
+		config:    config,
+		clock:     hlc.New(),
+		watchers:  newWatchHub(),
+		snapshots: newSnapshotter(snapshotPath, 0),
+	}
+	srv.cache = cache.New(10, 100, time.Second*3600, cache.WithListener(srv.onChange))
+
+	// Both a corrupt snapshot and a corrupt log are reported and set aside, instead of being used any further.
+	err := srv.loadSnapshot()
+	require.ErrorIs(t, err, snapshot.ErrCorrupt, "expected %v, instead got %v", snapshot.ErrCorrupt, err)
+	err = srv.openLog()
+	require.ErrorIs(t, err, aof.ErrCorrupt, "expected %v, instead got %v", aof.ErrCorrupt, err)
+	for _, path := range []string{snapshotPath, aofPath} {
+		_, err := os.Stat(path + ".corrupt")
+		require.NoError(t, err, "expected no error, instead got %v", err)
+	}
+
+	// A new log is opened in place of the corrupt one.
+	srv.cache.Set(&pb.SetRequest{Key: "key1", Value: []byte("value1"), Version: 1})
+	require.NoError(t, srv.awaitLog(0), "expected no error on await")
+	srv.closeLog()
+
+	var keys []string
+	_, _, err = aof.Replay(aofPath, func(entry *pb.Entry) { keys = append(keys, entry.Key) })
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, []string{"key1"}, keys, "expected %v, instead got %v", []string{"key1"}, keys)
+}
+
+func TestServerCorruptLogRecordSetAside(t *testing.T) {
+	aofPath := filepath.Join(t.TempDir(), "cache.aof")
+	l, err := aof.Open(aofPath, aof.FsyncAlways)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	for _, key := range []string{"key1", "key2", "key3"} {
+		err := l.Append(&pb.Entry{Key: key, Value: []byte("value"), Version: 1})
+		require.NoError(t, err, "expected no error, instead got %v", err)
+	}
+	require.NoError(t, l.Close(), "expected no error on close")
+
+	// Corrupt the second record, which is followed by an intact one.
+	data, err := os.ReadFile(aofPath)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	data[6+2*(len(data)-6)/3-1] ^= 0xff
+	require.NoError(t, os.WriteFile(aofPath, data, 0o644), "expected no error on write")
+
+	config, _ := config.New()
+	config.AOFPath = aofPath
+	config.AOFFsync = aof.FsyncAlways
+	srv := &cacheServer{config: config, clock: hlc.New(), watchers: newWatchHub()}
+	srv.cache = cache.New(10, 100, time.Second*3600, cache.WithListener(srv.onChange))
+
+	// The log is set aside as a whole, and the records restored before the corruption are kept in the new one.
+	err = srv.openLog()
+	require.ErrorIs(t, err, aof.ErrCorrupt, "expected %v, instead got %v", aof.ErrCorrupt, err)
+	corrupt, err := os.ReadFile(aofPath + ".corrupt")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, data, corrupt, "expected %v, instead got %v", data, corrupt)
+	srv.closeLog()
+
+	var keys []string
+	_, _, err = aof.Replay(aofPath, func(entry *pb.Entry) { keys = append(keys, entry.Key) })
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, []string{"key1"}, keys, "expected %v, instead got %v", []string{"key1"}, keys)
+}
+
+func TestServerLogFailureFailsWrite(t *testing.T) {
+	config, _ := config.New()
+	config.AOFPath = filepath.Join(t.TempDir(), "cache.aof")
+	config.AOFFsync = aof.FsyncAlways
+	srv := &cacheServer{config: config, clock: hlc.New(), watchers: newWatchHub()}
+	srv.cache = cache.New(10, 100, time.Second*3600, cache.WithListener(srv.onChange))
+	require.NoError(t, srv.openLog(), "expected no error on open")
+	defer srv.closeLog()
+
+	_, err := srv.Set(context.Background(), &pb.SetRequest{Key: "key1", Value: []byte("value1"), Version: 1, SourceNode: ":8081"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// A write whose change could not be appended to the log is not acknowledged.
+	require.NoError(t, srv.aof.Close(), "expected no error on close")
+	_, err = srv.Set(context.Background(), &pb.SetRequest{Key: "key2", Value: []byte("value2"), Version: 2, SourceNode: ":8081"})
+	require.Equal(t, codes.Internal, status.Code(err), "expected %v, instead got %v", codes.Internal, status.Code(err))
+	_, err = srv.Delete(context.Background(), &pb.DeleteRequest{Key: "key1", Version: 3, SourceNode: ":8081"})
+	require.Equal(t, codes.Internal, status.Code(err), "expected %v, instead got %v", codes.Internal, status.Code(err))
+}
+
+func TestServerRateLimit(t *testing.T) {
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	srv1.limiter = newRateLimiter(1, 2)
+
+	cc, err := grpc.NewClient(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	defer cc.Close()
+	client := pb.NewCacheServiceClient(cc)
+
+	ctx := context.Background()
+	_, err = srv1.Set(ctx, &pb.SetRequest{Key: "key", Value: []byte("value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	for i := 0; i < 2; i++ {
+		_, err := client.Get(ctx, &pb.GetRequest{Key: "key"})
+		require.NoError(t, err, "expected no error, instead got %v", err)
+	}
+
+	var header metadata.MD
+	_, err = client.Get(ctx, &pb.GetRequest{Key: "key"}, grpc.Header(&header))
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "expected %v, instead got %v", codes.ResourceExhausted, status.Code(err))
+	require.Equal(t, []string{"1"}, header.Get("retry-after"), "expected %v, instead got %v", []string{"1"}, header.Get("retry-after"))
+	details := status.Convert(err).Details()
+	require.Len(t, details, 1, "expected %v detail, instead got %v", 1, details)
+	require.IsType(t, &errdetails.RetryInfo{}, details[0], "expected %T, instead got %T", &errdetails.RetryInfo{}, details[0])
+
+	// Streams count against the same bucket.
+	stream, err := client.Watch(ctx, &pb.WatchRequest{Key: "key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "expected %v, instead got %v", codes.ResourceExhausted, status.Code(err))
+
+	// Requests forwarded by a member of the cluster are exempt.
+	peerClient, err := srv2.connPool.get(":8080")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = peerClient.Get(ctx, &pb.GetRequest{Key: "key", SourceNode: ":8081"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// Claiming to be a node that is not a member of the cluster does not bypass the limit.
+	spoofed := metadata.AppendToOutgoingContext(ctx, sourceNodeHeader, ":9090")
+	_, err = client.Get(spoofed, &pb.GetRequest{Key: "key", SourceNode: ":9090"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "expected %v, instead got %v", codes.ResourceExhausted, status.Code(err))
+
+	// With a cluster secret, claiming to be a member from the same host does not bypass the limit either.
+	srv1.config.ClusterSecret = "secret"
+	spoofed = metadata.AppendToOutgoingContext(ctx, sourceNodeHeader, ":8081")
+	_, err = client.Get(spoofed, &pb.GetRequest{Key: "key", SourceNode: ":8081"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "expected %v, instead got %v", codes.ResourceExhausted, status.Code(err))
+
+	spoofed = metadata.AppendToOutgoingContext(ctx, sourceNodeHeader, ":8081", clusterSecretHeader, "guess")
+	_, err = client.Get(spoofed, &pb.GetRequest{Key: "key", SourceNode: ":8081"})
+	require.Equal(t, codes.ResourceExhausted, status.Code(err), "expected %v, instead got %v", codes.ResourceExhausted, status.Code(err))
+
+	pool := newGrpcConnPool(grpc.WithChainUnaryInterceptor(sourceNodeUnaryInterceptor(":8081", "secret")))
+	peerClient, err = pool.get(":8080")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = peerClient.Get(ctx, &pb.GetRequest{Key: "key", SourceNode: ":8081"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+}
+
+func TestServerMetrics(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: "key", Value: []byte("value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, err = srv1.Get(ctx, &pb.GetRequest{Key: "key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// Both replicas answer that they hold no entry, which is a miss rather than a failed quorum.
+	missing := keyWithReadOrder(t, hashRing, ":8080", ":8081")
+	_, err = srv1.Get(ctx, &pb.GetRequest{Key: missing})
+	require.Equal(t, codes.NotFound, status.Code(err), "expected %v, instead got %v", codes.NotFound, status.Code(err))
+
+	// The third replica is unreachable, so that writes requiring all replicas fail.
+	hashRing.Replication = 3
+	_, err = srv1.Set(ctx, &pb.SetRequest{Key: "key", Value: []byte("value")})
+	require.Error(t, err, "expected an error, instead got %v", err)
+
+	recorder := httptest.NewRecorder()
+	srv1.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(recorder.Result().Body)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	metrics := string(body)
+
+	for _, metric := range []string{
+		"cache_hits_total 1",
+		`cache_quorum_failures_total{op="write"} 1`,
+		`cache_forward_errors_total{op="set",peer=":8082"} 1`,
+		"cache_read_misses_total 1",
+		`cache_forward_duration_seconds_count{op="get",peer=":8081"} 2`,
+		`cache_shard_items{shard="0"}`,
+		"cache_ring_nodes 3",
+		"cache_evictions_total 0",
+		"cache_expirations_total 0",
+	} {
+		require.True(t, strings.Contains(metrics, metric), "expected %v in metrics, instead got %v", metric, metrics)
+	}
+}
+
+func TestServerTracePropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	addrs := []string{":8080", ":8081"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: "key", Value: []byte("value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	cc, err := grpc.NewClient(":8080", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	defer cc.Close()
+
+	_, err = pb.NewCacheServiceClient(cc).Get(ctx, &pb.GetRequest{Key: "key"})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// The Get of the client and the Get forwarded to the replica are served within the same trace.
+	// Server spans end once the response was sent, so they may be recorded shortly after the client returned.
+	method := strings.TrimPrefix(pb.CacheService_Get_FullMethodName, "/")
+	var traceIDs []trace.TraceID
+	require.Eventually(t, func() bool {
+		traceIDs = nil
+		for _, span := range recorder.Ended() {
+			if span.Name() == method && span.SpanKind() == trace.SpanKindServer {
+				traceIDs = append(traceIDs, span.SpanContext().TraceID())
+			}
+		}
+		return len(traceIDs) == 2
+	}, time.Second, 10*time.Millisecond, "expected %v server spans", 2)
+	require.Equal(t, traceIDs[0], traceIDs[1], "expected %v, instead got %v", traceIDs[0], traceIDs[1])
+}
+
+// Starts a listener on the port that accepts connections, but never answers, like a replica that hangs.
+func startUnresponsiveNode(t *testing.T, port string) {
+	lis, err := net.Listen("tcp", port)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+
+	t.Cleanup(func() {
+		lis.Close()
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+}
+
+func TestServerForwardingHonorsDeadlines(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 3)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	startUnresponsiveNode(t, ":8082")
+
+	// The write requiring all replicas gives up at the deadline of the client.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: "key", Value: []byte("value")})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err), "expected %v, instead got %v", codes.DeadlineExceeded, status.Code(err))
+	require.Less(t, time.Since(start), time.Second, "expected to return at the deadline, instead took %v", time.Since(start))
+
+	// Without a deadline of the client, the configured RPC timeout applies.
+	srv1.config.RPCTimeout = 100 * time.Millisecond
+	start = time.Now()
+	_, err = srv1.Set(context.Background(), &pb.SetRequest{Key: "key", Value: []byte("value")})
+	require.Equal(t, codes.Internal, status.Code(err), "expected %v, instead got %v", codes.Internal, status.Code(err))
+	require.Less(t, time.Since(start), time.Second, "expected to return at the RPC timeout, instead took %v", time.Since(start))
+
+	// Reads and writes return once the quorum is reached, without waiting for the unresponsive replica.
+	srv1.config.RPCTimeout = 5 * time.Second
+	start = time.Now()
+	_, err = srv1.Set(context.Background(), &pb.SetRequest{Key: "key", Value: []byte("value"), Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	result, err := srv1.Get(context.Background(), &pb.GetRequest{Key: "key", Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "value", string(result.Value), "expected %v, instead got %v", "value", string(result.Value))
+	require.Less(t, time.Since(start), time.Second, "expected to return at the quorum, instead took %v", time.Since(start))
+}
+
+func TestServerBatchHonorsDeadlines(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 3)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	startUnresponsiveNode(t, ":8082")
+
+	// Batches return once the quorum of every key is reached, without waiting for the unresponsive replica.
+	entries := []*pb.SetRequest{{Key: "key1", Value: []byte("value1")}, {Key: "key2", Value: []byte("value2")}}
+	start := time.Now()
+	resp, err := srv1.MultiSet(context.Background(), &pb.MultiSetRequest{Entries: entries, Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	for _, result := range resp.Results {
+		require.Equal(t, codes.OK, codes.Code(result.Code), "expected %v, instead got %v", codes.OK, codes.Code(result.Code))
+	}
+	resp, err = srv1.MultiGet(context.Background(), &pb.MultiGetRequest{Keys: []string{"key1", "key2"}, Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	for i, result := range resp.Results {
+		require.Equal(t, string(entries[i].Value), string(result.Response.GetValue()), "expected %v, instead got %v", string(entries[i].Value), string(result.Response.GetValue()))
+	}
+	require.Less(t, time.Since(start), time.Second, "expected to return at the quorum, instead took %v", time.Since(start))
+
+	// Batches requiring all replicas give up at the deadline of the client, without counting quorum failures.
+	reads, writes := srv1.metrics.quorumFailures.WithLabelValues("read"), srv1.metrics.quorumFailures.WithLabelValues("write")
+	failures := testutil.ToFloat64(reads) + testutil.ToFloat64(writes)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = srv1.MultiSet(ctx, &pb.MultiSetRequest{Entries: entries})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err), "expected %v, instead got %v", codes.DeadlineExceeded, status.Code(err))
+	_, err = srv1.MultiGet(ctx, &pb.MultiGetRequest{Keys: []string{"key1", "key2"}})
+	require.Equal(t, codes.DeadlineExceeded, status.Code(err), "expected %v, instead got %v", codes.DeadlineExceeded, status.Code(err))
+	failed := testutil.ToFloat64(reads) + testutil.ToFloat64(writes) - failures
+	require.Zero(t, failed, "expected no quorum failures, instead got %v", failed)
+}
+
+func TestLatencyTrackerHedgeDelay(t *testing.T) {
+	disabled := newLatencyTracker(0)
+	disabled.observe(time.Millisecond)
+	_, ok := disabled.hedgeDelay()
+	require.False(t, ok, "expected %v, instead got %v", false, ok)
+
+	tracker := newLatencyTracker(90)
+	for i := 1; i < latencyMinSamples; i++ {
+		tracker.observe(time.Duration(i) * time.Millisecond)
+	}
+	_, ok = tracker.hedgeDelay()
+	require.False(t, ok, "expected no hedging before %v samples, instead got %v", latencyMinSamples, ok)
+
+	for i := latencyMinSamples; i <= 100; i++ {
+		tracker.observe(time.Duration(i) * time.Millisecond)
+	}
+	delay, ok := tracker.hedgeDelay()
+	require.True(t, ok, "expected %v, instead got %v", true, ok)
+	require.Equal(t, 90*time.Millisecond, delay, "expected %v, instead got %v", 90*time.Millisecond, delay)
+}
+
+// Returns a key whose replicas, with the local replica read first, are read in the given order.
+func keyWithReadOrder(t *testing.T, hashRing *hashring.HashRing, order ...string) string {
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key%d", i)
+		nodes, ok := hashRing.GetNodes(key)
+		require.True(t, ok, "expected %v, instead got %v", true, ok)
+
+		addrs := make([]string, len(nodes))
+		for j, node := range nodes {
+			addrs[j] = node.Addr
+		}
+		if j := slices.Index(addrs, order[0]); j > 0 {
+			addrs[0], addrs[j] = addrs[j], addrs[0]
+		}
+		if slices.Equal(addrs, order) {
+			return key
+		}
+	}
+	t.Fatalf("no key with read order %v found", order)
+	return ""
+}
+
+func TestServerHedgedRead(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 3)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	startUnresponsiveNode(t, ":8082")
+
+	srv1.readLatency = newLatencyTracker(95)
+	for i := 0; i < latencyMinSamples; i++ {
+		srv1.readLatency.observe(time.Millisecond)
+	}
+
+	// The quorum read first goes to the local and the unresponsive replica, then hedges to the remaining one.
+	key := keyWithReadOrder(t, hashRing, ":8080", ":8082", ":8081")
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: key, Value: []byte("value"), Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	start := time.Now()
+	result, err := srv1.Get(ctx, &pb.GetRequest{Key: key, Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "value", string(result.Value), "expected %v, instead got %v", "value", string(result.Value))
+	require.Less(t, time.Since(start), time.Second, "expected the hedged read to return, instead took %v", time.Since(start))
+
+	hedged := testutil.ToFloat64(srv1.metrics.hedgedReads)
+	require.Equal(t, float64(1), hedged, "expected %v hedged read, instead got %v", 1, hedged)
+}
+
+func TestServerReadDisagreeingReplicas(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 3)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	srv2, grpc2 := startServer(":8081", hashRing)
+	_, grpc3 := startServer(":8082", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	defer grpc3.Stop()
+	srv1.config.ReadRepair = config.ReadRepairSync
+
+	srv1.readLatency = newLatencyTracker(95)
+	for i := 0; i < latencyMinSamples; i++ {
+		srv1.readLatency.observe(time.Second)
+	}
+
+	key := keyWithReadOrder(t, hashRing, ":8080", ":8081", ":8082")
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: key, Value: []byte("value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// The first two replicas read disagree, so that the third one is read and repaired as well.
+	srv2.cache.Set(&pb.SetRequest{Key: key, Value: []byte("new-value")})
+
+	result, err := srv1.Get(ctx, &pb.GetRequest{Key: key, Consistency: pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "new-value", string(result.Value), "expected %v, instead got %v", "new-value", string(result.Value))
+	require.Equal(t, uint64(2), srv1.readRepairs.Load(), "expected %d repairs, instead got %d", 2, srv1.readRepairs.Load())
+
+	hedged := testutil.ToFloat64(srv1.metrics.hedgedReads)
+	require.Zero(t, hedged, "expected no hedged reads, instead got %v", hedged)
+}
+
+func TestServerCoordinatorOutsideReplicas(t *testing.T) {
+	addrs := []string{":8080", ":8081", ":8082"}
+	hashRing := createHashRing(addrs, 2)
+	srv1, grpc1 := startServer(":8080", hashRing)
+	_, grpc2 := startServer(":8081", hashRing)
+	_, grpc3 := startServer(":8082", hashRing)
+	defer grpc1.Stop()
+	defer grpc2.Stop()
+	defer grpc3.Stop()
+
+	key := keyWithReadOrder(t, hashRing, ":8081", ":8082")
+	ctx := context.Background()
+	_, err := srv1.Set(ctx, &pb.SetRequest{Key: key, Value: []byte("value")})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+
+	// The coordinator is not a replica of the key, so it does not keep a copy.
+	_, ok := srv1.cache.Lookup(key)
+	require.False(t, ok, "expected %v, instead got %v", false, ok)
+
+	result, err := srv1.Get(ctx, &pb.GetRequest{Key: key})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, "value", string(result.Value), "expected %v, instead got %v", "value", string(result.Value))
+
+	_, err = srv1.Delete(ctx, &pb.DeleteRequest{Key: key})
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	_, ok = srv1.cache.Lookup(key)
+	require.False(t, ok, "expected %v, instead got %v", false, ok)
+}
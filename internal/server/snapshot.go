@@ -0,0 +1,151 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hlc"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/snapshot"
+	"github.com/rs/zerolog/log"
+)
+
+// Periodically writes snapshots of the local cache to a file in the background, so that a restarted node
+// does not start with an empty cache. Each shard is copied while holding its lock, including the versions,
+// expiry times and tombstones of the entries.
+type snapshotter struct {
+	mu       sync.Mutex    // Mutex to synchronize starting and stopping the snapshotter.
+	saveMu   sync.Mutex    // Mutex to serialize writing snapshots.
+	stopCh   chan struct{} // Closed to signal the snapshot goroutine to stop.
+	doneCh   chan struct{} // Closed by the snapshot goroutine once it has stopped.
+	path     string        // Path of the snapshot file, empty disables snapshots.
+	interval time.Duration // Interval between two snapshots, zero only takes a snapshot on shutdown.
+	taken    atomic.Uint64 // Number of snapshots written.
+}
+
+// Creates and initializes a new snapshotter writing to the file at path every interval.
+func newSnapshotter(path string, interval time.Duration) *snapshotter {
+	return &snapshotter{path: path, interval: interval}
+}
+
+// Restores the entries of the snapshot file into the local cache.
+//
+// Entries that expired in the meantime are skipped, and the hybrid logical clock is advanced past the
+// restored versions, so that later writes coordinated by this node supersede them. A missing snapshot
+// starts the node with an empty cache. If the snapshot is corrupt or of an unsupported version, it is set aside
+// and the error is returned, as is any other error reading it.
+func (cs *cacheServer) loadSnapshot() error {
+	path := cs.snapshots.path
+	if path == "" {
+		return nil
+	}
+
+	entries, err := snapshot.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Info().Str("path", path).Msg("no snapshot found, starting with an empty cache")
+		return nil
+	}
+	if errors.Is(err, snapshot.ErrCorrupt) || errors.Is(err, snapshot.ErrUnsupportedVersion) {
+		return errors.Join(fmt.Errorf("failed to read snapshot: %w", err), setAside(path))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	now := time.Now().UnixNano()
+	restored := 0
+	for _, entry := range entries {
+		if entry.ExpiryTime != 0 && entry.ExpiryTime <= now {
+			continue
+		}
+		cs.clock.Update(hlc.Timestamp(entry.Version))
+		if cs.cache.Merge(entry) {
+			restored++
+		}
+	}
+
+	log.Info().Str("path", path).Int("entries", len(entries)).Int("restored", restored).Msg("restored snapshot")
+
+	return nil
+}
+
+// Writes a snapshot of the local cache to the snapshot file, replacing the previous one.
+// Calling it with snapshots disabled is a no-op.
+func (cs *cacheServer) saveSnapshot() error {
+	s := cs.snapshots
+	if s.path == "" {
+		return nil
+	}
+
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	start := time.Now()
+	count, err := snapshot.Write(s.path, func(fn func(entry *pb.Entry) bool) {
+		cs.cache.Range(fn)
+	})
+	if err != nil {
+		return err
+	}
+	s.taken.Add(1)
+
+	log.Info().Str("path", s.path).Int("entries", count).Dur("duration", time.Since(start)).Msg("wrote snapshot")
+	return nil
+}
+
+// Starts taking periodic snapshots in the background.
+// Calling it with a running snapshotter, with snapshots disabled or with a non-positive interval is a no-op.
+func (cs *cacheServer) startSnapshots() {
+	s := cs.snapshots
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" || s.interval <= 0 || s.stopCh != nil {
+		return
+	}
+
+	s.stopCh = make(chan struct{})
+	s.doneCh = make(chan struct{})
+
+	go cs.runSnapshots(s.stopCh, s.doneCh)
+}
+
+// Stops taking periodic snapshots and waits for the snapshotter to exit.
+// Calling it without a running snapshotter is a no-op.
+func (cs *cacheServer) stopSnapshots() {
+	s := cs.snapshots
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopCh == nil {
+		return
+	}
+
+	close(s.stopCh)
+	<-s.doneCh
+	s.stopCh = nil
+	s.doneCh = nil
+}
+
+// Takes a snapshot every interval until the stop channel is closed.
+func (cs *cacheServer) runSnapshots(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(cs.snapshots.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := cs.saveSnapshot(); err != nil {
+				log.Error().Err(err).Str("path", cs.snapshots.path).Msg("failed to write snapshot")
+			}
+		}
+	}
+}
@@ -5,17 +5,60 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/marvinlanhenke/go-distributed-cache/internal/cache"
 	"github.com/marvinlanhenke/go-distributed-cache/internal/config"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
 	"github.com/rs/zerolog/log"
 	"google.golang.org/grpc"
 )
 
 // GracefulShutdown listens for system interrupt signals (e.g., SIGINT, SIGTERM) and gracefully shuts down the gRPC server.
 // This function ensures that the server stops accepting new connections and allows in-progress requests to complete before shutting down.
-func GracefulShutdown(srv *grpc.Server, cfg *config.Config) {
+// Afterwards, the background processes of the cache server are stopped, and the function returns once they completed.
+func GracefulShutdown(srv *grpc.Server, cs *cacheServer, cfg *config.Config) {
 	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 	<-ch
 	log.Info().Str("addr", cfg.Addr).Msg("server shutting down...")
 	srv.GracefulStop()
+	cs.Close()
+}
+
+// Reports whether the response `a` should win over the response `b` during a quorum read.
+// The higher version wins; ties are broken deterministically, as described by `cache.Supersedes`.
+func isNewer(a, b *pb.GetResponse) bool {
+	if b == nil {
+		return true
+	}
+	return cache.Supersedes(a.Version, a.Tombstone, a.Value, b.Version, b.Tombstone, b.Value)
+}
+
+// Returns the number of replicas that have to acknowledge an operation at the given consistency level.
+// The default level requires the configured quorum, capped at the number of replicas, or all replicas if none is configured.
+func requiredReplicas(level pb.ConsistencyLevel, replicas, quorum int) int {
+	switch level {
+	case pb.ConsistencyLevel_CONSISTENCY_LEVEL_ONE:
+		return 1
+	case pb.ConsistencyLevel_CONSISTENCY_LEVEL_QUORUM:
+		return replicas/2 + 1
+	case pb.ConsistencyLevel_CONSISTENCY_LEVEL_ALL:
+		return replicas
+	default:
+		if quorum <= 0 {
+			return replicas
+		}
+		return min(quorum, replicas)
+	}
+}
+
+// Converts a cache entry into the GetResponse returned by a replica.
+func toGetResponse(entry *pb.Entry) *pb.GetResponse {
+	return &pb.GetResponse{
+		Value:       entry.Value,
+		Version:     entry.Version,
+		Tombstone:   entry.Tombstone,
+		ExpiryTime:  entry.ExpiryTime,
+		ContentType: entry.ContentType,
+		Flags:       entry.Flags,
+	}
 }
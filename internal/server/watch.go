@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/cache"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/hashring"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	watchBufferSize = 256  // Number of events buffered per watcher before it is considered too slow.
+	watchDedupSize  = 4096 // Number of recently delivered events remembered per watch to drop duplicates.
+)
+
+// Maps the event types of the cache onto the event types of the API.
+var eventTypes = map[cache.EventType]pb.EventType{
+	cache.EventSet:    pb.EventType_EVENT_TYPE_SET,
+	cache.EventDelete: pb.EventType_EVENT_TYPE_DELETE,
+	cache.EventExpire: pb.EventType_EVENT_TYPE_EXPIRE,
+}
+
+// Represents a subscription to the changes of a key, or of all keys with a prefix, in the local cache.
+type watcher struct {
+	key    string              // Key, or key prefix, to watch.
+	prefix bool                // Whether the key is matched as a prefix.
+	events chan *pb.WatchEvent // Buffered events, closed if the watcher fell behind.
+}
+
+// Reports whether the watcher is interested in changes to the key.
+func (w *watcher) matches(key string) bool {
+	if w.prefix {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+// Distributes the changes to entries of the local cache to the registered watchers.
+type watchHub struct {
+	mu       sync.Mutex            // Mutex to synchronize access to the watchers.
+	watchers map[*watcher]struct{} // Registered watchers.
+}
+
+// Creates an empty watchHub.
+func newWatchHub() *watchHub {
+	return &watchHub{watchers: make(map[*watcher]struct{})}
+}
+
+// Registers a watcher for the key, or for all keys with the prefix.
+func (h *watchHub) subscribe(key string, prefix bool) *watcher {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	w := &watcher{key: key, prefix: prefix, events: make(chan *pb.WatchEvent, watchBufferSize)}
+	h.watchers[w] = struct{}{}
+
+	return w
+}
+
+// Unregisters the watcher, closing its channel unless that happened already.
+func (h *watchHub) unsubscribe(w *watcher) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.watchers[w]; ok {
+		delete(h.watchers, w)
+		close(w.events)
+	}
+}
+
+// Delivers a change of the local cache to all matching watchers; it is registered as the listener of the cache.
+// Watchers whose buffer is full are unregistered instead of blocking the cache.
+func (h *watchHub) publish(event cache.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.watchers) == 0 {
+		return
+	}
+
+	watchEvent := &pb.WatchEvent{Type: eventTypes[event.Type], Entry: event.Entry}
+	for w := range h.watchers {
+		if !w.matches(event.Entry.Key) {
+			continue
+		}
+		select {
+		case w.events <- watchEvent:
+		default:
+			delete(h.watchers, w)
+			close(w.events)
+		}
+	}
+}
+
+// Watch streams set, delete and expire events for a key, or for all keys with a prefix, until the client cancels.
+//
+// Changes are observed by the nodes that store the affected entries. The receiving node watches its local cache and
+// relays the events of the replicas responsible for the key, or of all other nodes for a prefix, which it watches
+// via forwarded Watch streams. Since every replica reports the same change, duplicate events are dropped.
+// Watchers that cannot keep up with the events are disconnected with a ResourceExhausted error, and watchers
+// losing the stream of a relevant node are disconnected with an Unavailable error, so that clients can resubscribe.
+func (cs *cacheServer) Watch(req *pb.WatchRequest, stream pb.CacheService_WatchServer) error {
+	if req.Key == "" && !req.Prefix {
+		return status.Errorf(codes.InvalidArgument, "key must not be empty")
+	}
+
+	w := cs.watchers.subscribe(req.Key, req.Prefix)
+	defer cs.watchers.unsubscribe(w)
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	remote := make(chan *pb.WatchEvent, watchBufferSize)
+	relayErrs := make(chan error, 1)
+	if req.SourceNode == "" {
+		for _, target := range cs.watchTargets(req) {
+			go func(target string) {
+				if err := cs.relayWatch(ctx, req, target, remote); err != nil {
+					select {
+					case relayErrs <- err:
+					default:
+					}
+				}
+			}(target)
+		}
+	}
+
+	delivered := newEventFilter(watchDedupSize)
+	for {
+		var event *pb.WatchEvent
+		select {
+		case <-ctx.Done():
+			return nil
+		case e, ok := <-w.events:
+			if !ok {
+				return status.Errorf(codes.ResourceExhausted, "watcher fell behind")
+			}
+			event = e
+		case event = <-remote:
+		case err := <-relayErrs:
+			return status.Errorf(codes.Unavailable, "lost watch stream of a replica: %v", err)
+		}
+
+		if !delivered.add(event) {
+			continue
+		}
+		if err := stream.Send(event); err != nil {
+			return err
+		}
+	}
+}
+
+// Returns the addresses of the other nodes whose changes are relevant to the watch request:
+// the replicas of the key, or all nodes of the ring when watching a prefix.
+func (cs *cacheServer) watchTargets(req *pb.WatchRequest) []string {
+	var nodes []*hashring.Node
+	if req.Prefix {
+		nodes = cs.hashRing.Nodes()
+	} else {
+		nodes, _ = cs.hashRing.GetNodes(req.Key)
+	}
+
+	targets := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Addr != cs.config.Addr {
+			targets = append(targets, node.Addr)
+		}
+	}
+	return targets
+}
+
+// Opens a forwarded Watch stream to the target node and relays its events until the context is canceled.
+// It returns an error if the stream could not be opened or was closed before the context was canceled.
+func (cs *cacheServer) relayWatch(ctx context.Context, req *pb.WatchRequest, target string, events chan<- *pb.WatchEvent) error {
+	client, err := cs.connPool.get(target)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create grpc client while forwarding watch request")
+		return err
+	}
+
+	stream, err := client.Watch(ctx, &pb.WatchRequest{Key: req.Key, Prefix: req.Prefix, SourceNode: cs.config.Addr})
+	if err != nil {
+		log.Error().Err(err).Str("addr", target).Msg("failed to forward watch request")
+		return err
+	}
+
+	for {
+		event, err := stream.Recv()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == io.EOF {
+			return fmt.Errorf("watch stream of node %q closed", target)
+		}
+		if err != nil {
+			log.Warn().Err(err).Str("addr", target).Msg("watch stream of target node failed")
+			return err
+		}
+
+		select {
+		case events <- event:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Remembers a bounded number of recently delivered events, identified by their type, key and version.
+type eventFilter struct {
+	seen  map[string]struct{} // Identifiers of the remembered events.
+	order []string            // Identifiers in the order they were added, used as a ring buffer.
+	next  int                 // Position in the ring buffer to overwrite next.
+}
+
+// Creates an empty eventFilter remembering up to `size` events.
+func newEventFilter(size int) *eventFilter {
+	return &eventFilter{
+		seen:  make(map[string]struct{}, size),
+		order: make([]string, 0, size),
+	}
+}
+
+// Remembers the event and reports whether it was not seen before.
+func (f *eventFilter) add(event *pb.WatchEvent) bool {
+	id := fmt.Sprintf("%d/%d/%s", event.Type, event.Entry.Version, event.Entry.Key)
+	if _, ok := f.seen[id]; ok {
+		return false
+	}
+
+	if len(f.order) < cap(f.order) {
+		f.order = append(f.order, id)
+	} else {
+		delete(f.seen, f.order[f.next])
+		f.order[f.next] = id
+		f.next = (f.next + 1) % len(f.order)
+	}
+	f.seen[id] = struct{}{}
+
+	return true
+}
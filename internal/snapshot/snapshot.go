@@ -0,0 +1,329 @@
+package snapshot
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+)
+
+// FormatVersion is the version of the binary format written by Encode.
+// Decode rejects snapshots of other versions instead of misinterpreting them.
+const FormatVersion = 1
+
+const (
+	magic        = "GDCS"  // Identifies a snapshot file.
+	recordEntry  = 1       // Tag of a record holding a cache entry.
+	recordEnd    = 0       // Tag of the trailer, holding the number of entries and the checksum.
+	maxFieldSize = 1 << 30 // Upper bound of a length-prefixed field, to reject corrupt lengths before allocating.
+)
+
+var (
+	// ErrCorrupt is returned when a snapshot is truncated, malformed or does not match its checksum.
+	ErrCorrupt = errors.New("snapshot is corrupt")
+
+	// ErrUnsupportedVersion is returned when a snapshot was written in an unknown version of the format.
+	ErrUnsupportedVersion = errors.New("snapshot format version is not supported")
+)
+
+// Encode writes the entries yielded by `rangeFn` to w and returns the number of entries written.
+//
+// A snapshot starts with a header of the magic bytes "GDCS" and the big-endian uint16 format version. It is followed
+// by one record per entry, holding the length-prefixed key, value and content type, the flags, the version, the
+// expiry time in nanoseconds since the epoch and the tombstone flag, all integers encoded as varints. The trailer
+// holds the number of entries and the big-endian CRC-32 (IEEE) checksum of all preceding bytes.
+func Encode(w io.Writer, rangeFn func(fn func(entry *pb.Entry) bool)) (int, error) {
+	checksum := crc32.NewIEEE()
+	bw := bufio.NewWriter(io.MultiWriter(w, checksum))
+	enc := &encoder{w: bw}
+
+	enc.write([]byte(magic))
+	enc.write(binary.BigEndian.AppendUint16(nil, FormatVersion))
+
+	count := 0
+	rangeFn(func(entry *pb.Entry) bool {
+		enc.byte(recordEntry)
+		enc.bytes([]byte(entry.Key))
+		enc.bytes(entry.Value)
+		enc.bytes([]byte(entry.ContentType))
+		enc.uvarint(uint64(entry.Flags))
+		enc.uvarint(entry.Version)
+		enc.varint(entry.ExpiryTime)
+		if entry.Tombstone {
+			enc.byte(1)
+		} else {
+			enc.byte(0)
+		}
+		count++
+		return enc.err == nil
+	})
+
+	enc.byte(recordEnd)
+	enc.uvarint(uint64(count))
+	if enc.err != nil {
+		return 0, enc.err
+	}
+	if err := bw.Flush(); err != nil {
+		return 0, err
+	}
+
+	if _, err := w.Write(binary.BigEndian.AppendUint32(nil, checksum.Sum32())); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Decode reads a snapshot written by Encode from r and returns its entries.
+// The entries are only returned once the whole snapshot has been read and its checksum verified.
+func Decode(r io.Reader) ([]*pb.Entry, error) {
+	checksum := crc32.NewIEEE()
+	dec := &decoder{r: bufio.NewReader(r), checksum: checksum}
+
+	header := dec.read(len(magic) + 2)
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if string(header[:len(magic)]) != magic {
+		return nil, fmt.Errorf("%w: missing magic bytes", ErrCorrupt)
+	}
+	if version := binary.BigEndian.Uint16(header[len(magic):]); version != FormatVersion {
+		return nil, fmt.Errorf("%w: got version %d, expected %d", ErrUnsupportedVersion, version, FormatVersion)
+	}
+
+	var entries []*pb.Entry
+	for dec.err == nil {
+		tag := dec.byte()
+		if tag == recordEnd {
+			break
+		}
+		if tag != recordEntry {
+			return nil, fmt.Errorf("%w: unknown record tag %d", ErrCorrupt, tag)
+		}
+
+		entry := &pb.Entry{
+			Key:         string(dec.bytes()),
+			Value:       dec.bytes(),
+			ContentType: string(dec.bytes()),
+			Flags:       uint32(dec.uvarint()),
+			Version:     dec.uvarint(),
+			ExpiryTime:  dec.varint(),
+			Tombstone:   dec.byte() == 1,
+		}
+		entries = append(entries, entry)
+	}
+
+	count := dec.uvarint()
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if count != uint64(len(entries)) {
+		return nil, fmt.Errorf("%w: got %d entries, expected %d", ErrCorrupt, len(entries), count)
+	}
+
+	sum := checksum.Sum32()
+	trailer := dec.read(4)
+	if dec.err != nil {
+		return nil, dec.err
+	}
+	if binary.BigEndian.Uint32(trailer) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorrupt)
+	}
+
+	return entries, nil
+}
+
+// Write encodes the entries yielded by `rangeFn` into the snapshot file at path and returns the number of entries.
+// The snapshot is written to a temporary file in the same directory, synced and renamed, so that the file at path
+// always holds a complete snapshot, even if the process crashes while writing.
+func Write(path string, rangeFn func(fn func(entry *pb.Entry) bool)) (int, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	count, err := Encode(tmp, rangeFn)
+	if err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return 0, err
+	}
+
+	return count, syncDir(dir)
+}
+
+// Read decodes the snapshot file at path and returns its entries.
+// If the file does not exist, the returned error wraps `fs.ErrNotExist`.
+func Read(path string) ([]*pb.Entry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Decode(f)
+}
+
+// Syncs the directory, so that a rename within it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Writes the fields of a snapshot, remembering the first error.
+type encoder struct {
+	w   *bufio.Writer               // Buffered destination of the snapshot.
+	buf [binary.MaxVarintLen64]byte // Scratch space for encoding varints.
+	err error                       // First error encountered while writing.
+}
+
+// Writes the raw bytes.
+func (e *encoder) write(p []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+// Writes a single byte.
+func (e *encoder) byte(b byte) {
+	if e.err == nil {
+		e.err = e.w.WriteByte(b)
+	}
+}
+
+// Writes an unsigned varint.
+func (e *encoder) uvarint(v uint64) {
+	e.write(e.buf[:binary.PutUvarint(e.buf[:], v)])
+}
+
+// Writes a signed varint.
+func (e *encoder) varint(v int64) {
+	e.write(e.buf[:binary.PutVarint(e.buf[:], v)])
+}
+
+// Writes the bytes prefixed with their length.
+func (e *encoder) bytes(p []byte) {
+	e.uvarint(uint64(len(p)))
+	e.write(p)
+}
+
+// Reads the fields of a snapshot, feeding every byte read into the checksum and remembering the first error.
+type decoder struct {
+	r        *bufio.Reader // Buffered source of the snapshot.
+	checksum hash.Hash32   // Checksum of all bytes read so far.
+	err      error         // First error encountered while reading.
+}
+
+// Reads exactly n raw bytes.
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	p := make([]byte, n)
+	if _, err := io.ReadFull(d.r, p); err != nil {
+		d.fail(err)
+		return nil
+	}
+	d.checksum.Write(p)
+	return p
+}
+
+// Reads a single byte.
+func (d *decoder) byte() byte {
+	p := d.read(1)
+	if p == nil {
+		return 0
+	}
+	return p[0]
+}
+
+// Reads an unsigned varint.
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(byteReader{d})
+	if err != nil {
+		// Errors of the underlying reader were recorded already, the remaining ones are overflows.
+		d.fail(fmt.Errorf("%w: %v", ErrCorrupt, err))
+	}
+	return v
+}
+
+// Reads a signed varint.
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(byteReader{d})
+	if err != nil {
+		// Errors of the underlying reader were recorded already, the remaining ones are overflows.
+		d.fail(fmt.Errorf("%w: %v", ErrCorrupt, err))
+	}
+	return v
+}
+
+// Reads bytes prefixed with their length.
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > maxFieldSize {
+		d.fail(fmt.Errorf("%w: field of %d bytes exceeds the limit", ErrCorrupt, n))
+		return nil
+	}
+	return d.read(int(n))
+}
+
+// Records the first error, reporting truncated and malformed snapshots as ErrCorrupt.
+func (d *decoder) fail(err error) {
+	if d.err != nil {
+		return
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	d.err = err
+}
+
+// Adapts the decoder to an io.ByteReader, so that varints are fed into the checksum as well.
+type byteReader struct{ d *decoder }
+
+// Reads a single byte, recording errors of the underlying reader in the decoder.
+func (b byteReader) ReadByte() (byte, error) {
+	c, err := b.d.r.ReadByte()
+	if err != nil {
+		b.d.fail(err)
+		return 0, err
+	}
+	b.d.checksum.Write([]byte{c})
+	return c, nil
+}
@@ -0,0 +1,92 @@
+package snapshot_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"testing"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/pb"
+	"github.com/marvinlanhenke/go-distributed-cache/internal/snapshot"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+)
+
+func testEntries() []*pb.Entry {
+	return []*pb.Entry{
+		{Key: "key1", Value: []byte("value1"), Version: 7311012345678901248, ExpiryTime: 1735689600000000000},
+		{Key: "key2", Value: []byte{0x00, 0xff, 0x10}, ContentType: "application/octet-stream", Flags: 42, Version: 2},
+		{Key: "key3", Version: 3, Tombstone: true},
+	}
+}
+
+func rangeOver(entries []*pb.Entry) func(fn func(entry *pb.Entry) bool) {
+	return func(fn func(entry *pb.Entry) bool) {
+		for _, entry := range entries {
+			if !fn(entry) {
+				return
+			}
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	entries := testEntries()
+
+	var buf bytes.Buffer
+	count, err := snapshot.Encode(&buf, rangeOver(entries))
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, len(entries), count, "expected %v, instead got %v", len(entries), count)
+
+	decoded, err := snapshot.Decode(&buf)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Len(t, decoded, len(entries), "expected %v entries, instead got %v", len(entries), len(decoded))
+	for i := range entries {
+		require.True(t, proto.Equal(entries[i], decoded[i]), "expected %v, instead got %v", entries[i], decoded[i])
+	}
+}
+
+func TestSnapshotRejectsCorruption(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := snapshot.Encode(&buf, rangeOver(testEntries()))
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	data := buf.Bytes()
+
+	flipped := bytes.Clone(data)
+	flipped[len(flipped)/2] ^= 0xff
+	_, err = snapshot.Decode(bytes.NewReader(flipped))
+	require.ErrorIs(t, err, snapshot.ErrCorrupt, "expected %v, instead got %v", snapshot.ErrCorrupt, err)
+
+	for _, n := range []int{0, 3, len(data) / 2, len(data) - 1} {
+		_, err = snapshot.Decode(bytes.NewReader(data[:n]))
+		require.ErrorIs(t, err, snapshot.ErrCorrupt, "expected %v for %d bytes, instead got %v", snapshot.ErrCorrupt, n, err)
+	}
+
+	unsupported := bytes.Clone(data)
+	unsupported[5] = snapshot.FormatVersion + 1
+	_, err = snapshot.Decode(bytes.NewReader(unsupported))
+	require.ErrorIs(t, err, snapshot.ErrUnsupportedVersion, "expected %v, instead got %v", snapshot.ErrUnsupportedVersion, err)
+}
+
+func TestSnapshotWriteAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data", "snapshot.bin")
+
+	_, err := snapshot.Read(path)
+	require.True(t, errors.Is(err, fs.ErrNotExist), "expected %v, instead got %v", fs.ErrNotExist, err)
+
+	entries := testEntries()
+	_, err = snapshot.Write(path, rangeOver(entries[:1]))
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	count, err := snapshot.Write(path, rangeOver(entries))
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, len(entries), count, "expected %v, instead got %v", len(entries), count)
+
+	decoded, err := snapshot.Read(path)
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Len(t, decoded, len(entries), "expected %v entries, instead got %v", len(entries), len(decoded))
+
+	files, err := filepath.Glob(filepath.Join(filepath.Dir(path), "*"))
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, []string{path}, files, "expected %v, instead got %v", []string{path}, files)
+}
@@ -0,0 +1,80 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Name of the service reported with each span, unless overridden by OTEL_SERVICE_NAME.
+const ServiceName = "go-distributed-cache"
+
+// Exporter selects where the spans of the node are sent.
+type Exporter string
+
+const (
+	ExporterNone   Exporter = "none"   // Spans are not recorded, but trace context is still propagated.
+	ExporterStdout Exporter = "stdout" // Spans are written to stdout, for local testing.
+	ExporterOTLP   Exporter = "otlp"   // Spans are sent to an OTLP collector over gRPC.
+)
+
+// ParseExporter returns the exporter with the given name.
+func ParseExporter(name string) (Exporter, error) {
+	switch exporter := Exporter(name); exporter {
+	case ExporterNone, ExporterStdout, ExporterOTLP:
+		return exporter, nil
+	default:
+		return "", fmt.Errorf("unknown tracing exporter %q", name)
+	}
+}
+
+// Setup installs the global tracer provider exporting the spans of the node with the given address,
+// and the W3C trace context and baggage propagators, so that traces continue across forwarded requests.
+//
+// The OTLP exporter and the sampler are configured by the standard OpenTelemetry environment variables,
+// like OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_TRACES_SAMPLER. The returned function flushes the pending spans
+// and shuts down the tracer provider.
+func Setup(ctx context.Context, exporter Exporter, addr string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		spanExporter, err = otlptracegrpc.New(ctx)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s exporter: %w", exporter, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName), semconv.ServiceInstanceID(addr)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create tracing resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
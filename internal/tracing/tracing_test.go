@@ -0,0 +1,27 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/marvinlanhenke/go-distributed-cache/internal/tracing"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExporter(t *testing.T) {
+	exporter, err := tracing.ParseExporter("otlp")
+	require.NoError(t, err, "expected no error, instead got %v", err)
+	require.Equal(t, tracing.ExporterOTLP, exporter, "expected %v, instead got %v", tracing.ExporterOTLP, exporter)
+
+	_, err = tracing.ParseExporter("jaeger")
+	require.Error(t, err, "expected an error for an unknown exporter")
+}
+
+func TestSetup(t *testing.T) {
+	ctx := context.Background()
+	for _, exporter := range []tracing.Exporter{tracing.ExporterNone, tracing.ExporterStdout} {
+		shutdown, err := tracing.Setup(ctx, exporter, "localhost:8080")
+		require.NoError(t, err, "expected no error, instead got %v", err)
+		require.NoError(t, shutdown(ctx), "expected no error on shutdown with exporter %v", exporter)
+	}
+}